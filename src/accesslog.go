@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/pkg/errors"
+)
+
+const (
+	accessLogStateKey = "accessLog"
+
+	combinedLogFormatName = "combined"
+	combinedLogFormat     = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+	accessLogOff = "off"
+)
+
+var accessLogDefinition = map[string][]interface{}{
+	"accessLog.requestsPerSecond":         {"requests", metric.PRATE},
+	"accessLog.responses1xxPerSecond":     {"responses.1xx", metric.PRATE},
+	"accessLog.responses2xxPerSecond":     {"responses.2xx", metric.PRATE},
+	"accessLog.responses3xxPerSecond":     {"responses.3xx", metric.PRATE},
+	"accessLog.responses4xxPerSecond":     {"responses.4xx", metric.PRATE},
+	"accessLog.responses5xxPerSecond":     {"responses.5xx", metric.PRATE},
+	"accessLog.bytesSentPerSecond":        {"bytes_sent", metric.PRATE},
+	"accessLog.requestTimeP50Ms":          {"request_time.p50", metric.GAUGE},
+	"accessLog.requestTimeP90Ms":          {"request_time.p90", metric.GAUGE},
+	"accessLog.requestTimeP99Ms":          {"request_time.p99", metric.GAUGE},
+	"accessLog.upstreamResponseTimeP50Ms": {"upstream_response_time.p50", metric.GAUGE},
+	"accessLog.upstreamResponseTimeP90Ms": {"upstream_response_time.p90", metric.GAUGE},
+	"accessLog.upstreamResponseTimeP99Ms": {"upstream_response_time.p99", metric.GAUGE},
+}
+
+// accessLogCounters are the raw metrics accumulated in the state of the access log.
+var accessLogCounters = []string{
+	"requests", "responses.1xx", "responses.2xx", "responses.3xx", "responses.4xx", "responses.5xx", "bytes_sent",
+}
+
+var (
+	logFormatVariable     = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+	upstreamTimesSplitter = regexp.MustCompile(`\s*[,:]\s*`)
+)
+
+// accessLogParser extracts the values of the log_format variables from access log lines.
+type accessLogParser struct {
+	re        *regexp.Regexp
+	variables []string
+}
+
+func newAccessLogParser(format string) (*accessLogParser, error) {
+	var pattern strings.Builder
+	var variables []string
+
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range logFormatVariable.FindAllStringSubmatchIndex(format, -1) {
+		pattern.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		pattern.WriteString("(.*?)")
+		if loc[2] >= 0 {
+			variables = append(variables, format[loc[2]:loc[3]])
+		} else {
+			variables = append(variables, format[loc[4]:loc[5]])
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]))
+	pattern.WriteString("$")
+
+	if len(variables) == 0 {
+		return nil, errors.Errorf("log format without variables: %s", format)
+	}
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+	return &accessLogParser{re: re, variables: variables}, nil
+}
+
+// parse returns the value of each variable in the line. If a variable appears more than once, its first value is
+// returned.
+func (p *accessLogParser) parse(line string) (map[string]string, bool) {
+	match := p.re.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if match == nil {
+		return nil, false
+	}
+
+	values := make(map[string]string, len(p.variables))
+	for i, variable := range p.variables {
+		if _, ok := values[variable]; !ok {
+			values[variable] = match[i+1]
+		}
+	}
+	return values, true
+}
+
+// accessLogConfig returns the access log path and its log_format from the http block of the configuration file: the
+// first access_log writing to a file, relative to nginxPrefix. When pathOverride is set, it's used as the access log
+// path.
+func accessLogConfig(configPath, nginxPrefix, pathOverride string) (string, string, error) {
+	directives, err := configDirectives(configPath)
+	if err != nil {
+		if pathOverride == "" {
+			return "", "", err
+		}
+		return pathOverride, combinedLogFormat, nil
+	}
+
+	path, formatName := pathOverride, combinedLogFormatName
+	var pathErr error
+	for _, d := range directives["http/access_log"] {
+		if len(d.args) == 0 || d.args[0] == accessLogOff {
+			continue
+		}
+		filePath, err := logFilePath("access_log", d.args[0], configPath, nginxPrefix)
+		if err != nil {
+			pathErr = err
+			continue
+		}
+		if path == "" {
+			path = filePath
+		}
+		if len(d.args) > 1 && !strings.Contains(d.args[1], "=") {
+			formatName = d.args[1]
+		}
+		break
+	}
+	if path == "" {
+		switch {
+		case pathErr != nil:
+			return "", "", pathErr
+		case serverAccessLogs(directives):
+			return "", "", errors.Errorf("access_log is only set in server blocks of nginx config file '%s', "+
+				"set ACCESS_LOG_PATH to the one to read", configPath)
+		default:
+			return "", "", errors.Errorf("no access log found in nginx config file '%s'", configPath)
+		}
+	}
+
+	if formatName == combinedLogFormatName {
+		return path, combinedLogFormat, nil
+	}
+	for _, d := range directives["http/log_format"] {
+		if format, ok := parseLogFormat(d, formatName); ok {
+			return path, format, nil
+		}
+	}
+	return "", "", errors.Errorf("log_format %s not found in nginx config file '%s'", formatName, configPath)
+}
+
+// serverAccessLogs is true when access logs are set in the blocks inside the http block, e.g. per server.
+func serverAccessLogs(directives map[string][]*configDirective) bool {
+	for path, accessLogs := range directives {
+		if strings.HasPrefix(path, "http/") && strings.HasSuffix(path, "/access_log") && path != "http/access_log" {
+			for _, d := range accessLogs {
+				if len(d.args) > 0 && d.args[0] != accessLogOff {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseLogFormat returns the format of a log_format directive, if it defines the named format. The format is the
+// concatenation of the strings after the name and the optional escape parameter.
+func parseLogFormat(d *configDirective, name string) (string, bool) {
+	if len(d.args) < 2 || d.args[0] != name {
+		return "", false
+	}
+
+	var format strings.Builder
+	for n, arg := range d.args[1:] {
+		if n == 0 && strings.HasPrefix(arg, "escape=") {
+			continue
+		}
+		format.WriteString(arg)
+	}
+	return format.String(), true
+}
+
+// getAccessLogMetrics reads the access log lines appended since the previous execution and reports the request metrics
+// derived from them. The existing lines are skipped on the first execution.
+func (inst *instance) getAccessLogMetrics(sample *metric.Set) error {
+	store := inst.store
+	if store == nil {
+		return errors.New("access log metrics require a state store")
+	}
+
+	path, format, err := accessLogConfig(inst.args.ConfigPath, inst.args.NginxPrefix, inst.args.AccessLogPath)
+	if err != nil {
+		return err
+	}
+	parser, err := newAccessLogParser(format)
+	if err != nil {
+		return err
+	}
+
+	var rawMetrics map[string]interface{}
+	err = updateLogState(store, accessLogStateKey, accessLogCounters, func(state *logState, firstRead bool) error {
+		rawMetrics, err = readAccessLog(path, state, parser, firstRead)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return populateMetrics(sample, rawMetrics, presentDefinitions(rawMetrics, accessLogDefinition))
+}
+
+// readAccessLog reads the lines appended to the access log since the cursor in the state. It updates the state and
+// returns the raw metrics of the lines read.
+func readAccessLog(path string, state *logState, parser *accessLogParser, firstRead bool) (map[string]interface{}, error) {
+	var requestTimes, upstreamResponseTimes []float64
+	err := tailLog(path, &state.logCursor, firstRead, func(line string) {
+		values, ok := parser.parse(line)
+		if !ok {
+			return
+		}
+		state.Counters["requests"]++
+		if status := values["status"]; len(status) == 3 && status[0] >= '1' && status[0] <= '5' {
+			state.Counters[fmt.Sprintf("responses.%cxx", status[0])]++
+		}
+		if bytesSent, ok := parseAccessLogNumber(values, "bytes_sent", "body_bytes_sent"); ok {
+			state.Counters["bytes_sent"] += bytesSent
+		}
+		if requestTime, ok := parseAccessLogNumber(values, "request_time"); ok {
+			requestTimes = append(requestTimes, requestTime*1000)
+		}
+		if upstreamTime, ok := parseUpstreamTimes(values["upstream_response_time"]); ok {
+			upstreamResponseTimes = append(upstreamResponseTimes, upstreamTime*1000)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rawMetrics := make(map[string]interface{}, len(state.Counters)+6)
+	for counter, value := range state.Counters {
+		rawMetrics[counter] = value
+	}
+	addPercentiles(rawMetrics, "request_time", requestTimes)
+	addPercentiles(rawMetrics, "upstream_response_time", upstreamResponseTimes)
+	return rawMetrics, nil
+}
+
+// parseAccessLogNumber returns the numeric value of the first of the variables present in the line.
+func parseAccessLogNumber(values map[string]string, variables ...string) (float64, bool) {
+	for _, variable := range variables {
+		if value, ok := values[variable]; ok {
+			number, err := strconv.ParseFloat(value, 64)
+			return number, err == nil
+		}
+	}
+	return 0, false
+}
+
+// parseUpstreamTimes adds up the times of all the upstream servers contacted for a request, which NGINX separates with
+// commas, or colons for internal redirects. Servers that couldn't be reached are logged as "-".
+func parseUpstreamTimes(value string) (float64, bool) {
+	var sum float64
+	found := false
+	for _, part := range upstreamTimesSplitter.Split(strings.TrimSpace(value), -1) {
+		t, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			continue
+		}
+		sum += t
+		found = true
+	}
+	return sum, found
+}
+
+// addPercentiles adds the 50th, 90th and 99th nearest-rank percentiles of the values as <prefix>.p50, etc.
+func addPercentiles(rawMetrics map[string]interface{}, prefix string, values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+	for _, p := range []int{50, 90, 99} {
+		rank := int(math.Ceil(float64(p)/100*float64(len(values)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		rawMetrics[fmt.Sprintf("%s.p%d", prefix, p)] = values[rank]
+	}
+}
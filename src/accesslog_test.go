@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAccessLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" ` +
+	`"$http_user_agent" rt=$request_time urt=${upstream_response_time}`
+
+var testAccessLogLines = `10.0.0.1 - - [18/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0" rt=0.010 urt=0.008
+10.0.0.1 - - [18/Oct/2026:10:00:01 +0000] "GET /missing HTTP/1.1" 404 153 "-" "curl/8.0" rt=0.002 urt=-
+10.0.0.2 - bob [18/Oct/2026:10:00:02 +0000] "POST /api HTTP/1.1" 502 157 "-" "Mozilla/5.0 (X11)" rt=1.500 urt=0.500, 1.000
+not a valid line
+`
+
+func TestAccessLogParser(t *testing.T) {
+	parser, err := newAccessLogParser(testAccessLogFormat)
+	require.NoError(t, err)
+
+	values, ok := parser.parse(`10.0.0.2 - bob [18/Oct/2026:10:00:02 +0000] "POST /api HTTP/1.1" 502 157 "-" "Mozilla/5.0 (X11)" rt=1.500 urt=0.500, 1.000` + "\n")
+	require.True(t, ok)
+	assert.Equal(t, "bob", values["remote_user"])
+	assert.Equal(t, "POST /api HTTP/1.1", values["request"])
+	assert.Equal(t, "502", values["status"])
+	assert.Equal(t, "Mozilla/5.0 (X11)", values["http_user_agent"])
+	assert.Equal(t, "0.500, 1.000", values["upstream_response_time"])
+
+	_, ok = parser.parse("not a valid line")
+	assert.False(t, ok)
+
+	_, err = newAccessLogParser("static text")
+	assert.Error(t, err)
+}
+
+func TestParseLogFormat(t *testing.T) {
+	directives, err := parseConfig(strings.NewReader(`
+log_format main  '$remote_addr - $remote_user [$time_local] "$request" '
+                 '$status $body_bytes_sent "$http_referer" '
+                 '"$http_user_agent" "$http_x_forwarded_for"';
+log_format escaped escape=json "$remote_addr \"$request\" $status";
+`))
+	require.NoError(t, err)
+
+	format, ok := parseLogFormat(directives[0], "main")
+	assert.True(t, ok)
+	assert.Equal(t, `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`, format)
+
+	_, ok = parseLogFormat(directives[0], "other")
+	assert.False(t, ok)
+
+	format, ok = parseLogFormat(directives[1], "escaped")
+	assert.True(t, ok)
+	assert.Equal(t, `$remote_addr "$request" $status`, format)
+}
+
+func TestAccessLogConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	path, format, err := accessLogConfig(configPath, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/nginx/access.log", path)
+	assert.Contains(t, format, `"$http_x_forwarded_for"`)
+
+	// The log format is found among several ones.
+	config := strings.Replace(testNginxConf, "  access_log", "  log_format timed '$remote_addr $request_time';\n  access_log", 1)
+	config = strings.Replace(config, "access.log  main", "access.log timed", 1)
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0600))
+	_, format, err = accessLogConfig(configPath, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "$remote_addr $request_time", format)
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	// Quoted paths are unquoted.
+	require.NoError(t, os.WriteFile(configPath, []byte("http {\n  access_log \"/var/log/a.log\" combined;\n}\n"), 0600))
+	path, format, err = accessLogConfig(configPath, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/a.log", path)
+	assert.Equal(t, combinedLogFormat, format)
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	// Logs that aren't files are skipped, and relative paths are resolved from the NGINX prefix.
+	require.NoError(t, os.WriteFile(configPath, []byte("http {\n  access_log syslog:server=unix:/dev/log;\n  access_log logs/access.log;\n}\n"), 0600))
+	path, _, err = accessLogConfig(configPath, "/usr/local/nginx", "")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/usr/local/nginx", "logs/access.log"), path)
+	_, _, err = accessLogConfig(configPath, "", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NGINX_PREFIX")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("http {\n  access_log syslog:server=unix:/dev/log;\n}\n"), 0600))
+	_, _, err = accessLogConfig(configPath, "", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "isn't a file")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("http {\n  server {\n    access_log /var/log/a.log;\n  }\n}\n"), 0600))
+	_, _, err = accessLogConfig(configPath, "", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only set in server blocks")
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	path, _, err = accessLogConfig(configPath, "", "/tmp/access.log")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/access.log", path)
+
+	path, format, err = accessLogConfig(filepath.Join(t.TempDir(), "missing.conf"), "", "/tmp/access.log")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/access.log", path)
+	assert.Equal(t, combinedLogFormat, format)
+
+	_, _, err = accessLogConfig(filepath.Join(t.TempDir(), "missing.conf"), "", "")
+	assert.Error(t, err)
+}
+
+func TestReadAccessLog(t *testing.T) {
+	parser, err := newAccessLogParser(testAccessLogFormat)
+	require.NoError(t, err)
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("previous line\n"), 0600))
+
+	state := logState{Counters: map[string]float64{"requests": 0}}
+	rawMetrics, err := readAccessLog(logPath, &state, parser, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("previous line\n")), state.Offset)
+	assert.Equal(t, float64(0), rawMetrics["requests"], "existing lines are skipped on the first read")
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(testAccessLogLines + `10.0.0.1 - - [18/Oct/2026:10:00:03 +0000] "GET / HTTP/1.1" 200`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	rawMetrics, err = readAccessLog(logPath, &state, parser, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("previous line\n")+len(testAccessLogLines)), state.Offset, "partial lines aren't consumed")
+	assert.Equal(t, float64(3), rawMetrics["requests"])
+	assert.Equal(t, float64(1), rawMetrics["responses.2xx"])
+	assert.Equal(t, float64(1), rawMetrics["responses.4xx"])
+	assert.Equal(t, float64(1), rawMetrics["responses.5xx"])
+	assert.Equal(t, float64(612+153+157), rawMetrics["bytes_sent"])
+	assert.Equal(t, float64(10), rawMetrics["request_time.p50"])
+	assert.Equal(t, float64(1500), rawMetrics["request_time.p99"])
+	assert.Equal(t, float64(8), rawMetrics["upstream_response_time.p50"])
+	assert.Equal(t, float64(1500), rawMetrics["upstream_response_time.p90"])
+
+	// A truncated log is read from the beginning.
+	firstLine := testAccessLogLines[:strings.Index(testAccessLogLines, "\n")+1]
+	require.NoError(t, os.WriteFile(logPath, []byte(firstLine), 0600))
+	rawMetrics, err = readAccessLog(logPath, &state, parser, false)
+	require.NoError(t, err)
+	assert.Equal(t, float64(4), rawMetrics["requests"], "counters accumulate across reads")
+}
+
+func TestGetAccessLogMetrics(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	require.NoError(t, os.WriteFile(logPath, nil, 0600))
+
+	inst := &instance{args: argumentList{StatusURL: "http://localhost/status", ConfigPath: filepath.Join(dir, "missing.conf"), AccessLogPath: logPath}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	ms := inst.metricSet(e, "NginxSample", false)
+
+	assert.Error(t, inst.getAccessLogMetrics(ms))
+
+	inst.store = persist.NewInMemoryStore()
+	require.NoError(t, inst.getAccessLogMetrics(ms))
+	assert.Equal(t, float64(0), ms.Metrics["accessLog.requestsPerSecond"])
+	assert.NotContains(t, ms.Metrics, "accessLog.requestTimeP50Ms")
+}
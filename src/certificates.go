@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/log"
+	"github.com/pkg/errors"
+)
+
+const certificateEventType = "NginxCertificateSample"
+
+// errUnresolvableCertificate is the error of the certificates whose path has variables, e.g. $ssl_server_name, so it's
+// only known when NGINX handles a request.
+var errUnresolvableCertificate = errors.New("unresolvable certificate path with variables")
+
+// configCertificate is a certificate file set with ssl_certificate, with the servers using it.
+type configCertificate struct {
+	path    string
+	servers []string
+	// chain are the certificates in the file, the server certificate first. It's empty when err is set.
+	chain []*x509.Certificate
+	err   error
+}
+
+// configCertificates returns the certificates set with ssl_certificate in the server blocks of the http and stream
+// contexts, in the order they're found. As in NGINX, TLS servers without ssl_certificate use the ones of their context,
+// and relative paths are resolved from the configuration prefix.
+func configCertificates(directives []*configDirective, confPrefix string) []*configCertificate {
+	var certificates []*configCertificate
+	byPath := make(map[string]*configCertificate)
+	for _, context := range directives {
+		if !context.isBlock() || (context.name != "http" && context.name != "stream") {
+			continue
+		}
+
+		inherited := certificatePaths(context.block)
+		for _, server := range context.block {
+			if !server.isBlock() || server.name != "server" {
+				continue
+			}
+			paths := certificatePaths(server.block)
+			if len(paths) == 0 && serverTLS(server) {
+				paths = inherited
+			}
+
+			for _, path := range paths {
+				if !strings.Contains(path, "$") && !filepath.IsAbs(path) {
+					path = filepath.Join(confPrefix, path)
+				}
+				certificate, ok := byPath[path]
+				if !ok {
+					certificate = &configCertificate{path: path}
+					byPath[path] = certificate
+					certificates = append(certificates, certificate)
+				}
+				certificate.servers = append(certificate.servers, serverName(server))
+			}
+		}
+	}
+	return certificates
+}
+
+// loadCertificates returns the certificates set in the configuration, with their chains loaded from their files.
+func loadCertificates(directives []*configDirective, confPrefix string) []*configCertificate {
+	certificates := configCertificates(directives, confPrefix)
+	for _, c := range certificates {
+		if c.load(); c.err != nil {
+			log.Warn("Unable to load certificate '%s': %s", c.path, c.err)
+		}
+	}
+	return certificates
+}
+
+// certificatePaths returns the arguments of the ssl_certificate directives of a block.
+func certificatePaths(block []*configDirective) []string {
+	var paths []string
+	for _, d := range block {
+		if d.name == "ssl_certificate" && !d.isBlock() && len(d.args) > 0 {
+			paths = append(paths, d.args[0])
+		}
+	}
+	return paths
+}
+
+// serverName identifies a server block by its first server name, or its first listen address when it has none.
+func serverName(server *configDirective) string {
+	var listen string
+	for _, d := range server.block {
+		if len(d.args) == 0 || d.isBlock() {
+			continue
+		}
+		switch {
+		case d.name == "server_name" && d.args[0] != "" && d.args[0] != "_":
+			return d.args[0]
+		case d.name == "listen" && listen == "":
+			listen = d.args[0]
+		}
+	}
+	if listen != "" {
+		return listen
+	}
+	return "_"
+}
+
+// load reads the certificate chain from its file.
+func (c *configCertificate) load() {
+	if strings.Contains(c.path, "$") {
+		c.err = errUnresolvableCertificate
+		return
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		c.err = err
+		return
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		// The file may also have the private key, which isn't reported.
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			c.err = fmt.Errorf("invalid certificate in '%s': %w", c.path, err)
+			return
+		}
+		c.chain = append(c.chain, cert)
+	}
+	if len(c.chain) == 0 {
+		c.err = errors.Errorf("no PEM certificate found in '%s'", c.path)
+	}
+}
+
+// addCertificateItems reports the server certificate of every certificate file as an inventory item keyed by the
+// servers using it and its path, e.g. "certificates/example.com/:etc:nginx:example.com.crt". Certificates that couldn't
+// be loaded are reported with their error.
+func addCertificateItems(i *inventory.Inventory, certificates []*configCertificate) error {
+	for _, c := range certificates {
+		fields := map[string]interface{}{
+			"path":    c.path,
+			"servers": strings.Join(c.servers, ","),
+		}
+		if c.err != nil {
+			fields["error"] = c.err.Error()
+		} else {
+			cert := c.chain[0]
+			fields["subject"] = cert.Subject.String()
+			fields["sans"] = strings.Join(subjectAltNames(cert), ",")
+			fields["issuer"] = cert.Issuer.String()
+			fields["serial"] = cert.SerialNumber.Text(16)
+			fields["notAfter"] = cert.NotAfter.UTC().Format(time.RFC3339)
+			fields["chainLength"] = len(c.chain)
+		}
+
+		path := strings.Replace(c.path, "/", ":", -1)
+		for _, server := range c.servers {
+			key := fmt.Sprintf("certificates/%s/%s", strings.Replace(server, "/", ":", -1), path)
+			for field, value := range fields {
+				if err := i.SetItem(key, field, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// subjectAltNames returns the DNS names, IP addresses, emails and URIs the certificate is valid for.
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// populateCertificateSamples reports a sample per certificate file found in the configuration, with the days until its
+// server certificate expires, or the reason it couldn't be loaded.
+func (inst *instance) populateCertificateSamples(e *integration.Entity) error {
+	directives, confPrefix, err := inst.loadConfig()
+	if err != nil {
+		return err
+	}
+	for _, c := range loadCertificates(directives, confPrefix) {
+		ms := inst.metricSet(e, certificateEventType, inst.args.RemoteMonitoring, attribute.Attr("certificate.path", c.path))
+		rawMetrics := map[string]interface{}{
+			"certificate.servers": strings.Join(c.servers, ","),
+		}
+		if c.err != nil {
+			rawMetrics["certificate.error"] = c.err.Error()
+		} else {
+			cert := c.chain[0]
+			rawMetrics["certificate.subject"] = cert.Subject.String()
+			rawMetrics["certificate.issuer"] = cert.Issuer.String()
+			rawMetrics["certificate.notAfter"] = cert.NotAfter.UTC().Format(time.RFC3339)
+			rawMetrics["certificate.daysUntilExpiry"] = time.Until(cert.NotAfter).Hours() / 24
+		}
+
+		setRawMetrics(ms, rawMetrics)
+	}
+	return nil
+}
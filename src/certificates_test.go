@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sdk_args "github.com/newrelic/infra-integrations-sdk/v3/args"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateInventory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "ssl"), 0700))
+	defaultCert, _ := writeTestCertificate(t, filepath.Join(dir, "ssl"), "default.example.com", time.Now().Add(10*24*time.Hour))
+	apiCert, _ := writeTestCertificate(t, dir, "api.example.com", time.Now().Add(-24*time.Hour))
+	configPath := filepath.Join(dir, "nginx.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+http {
+  ssl_certificate ssl/default.example.com.crt;
+  server {
+    listen 443 ssl;
+    server_name www.example.com example.com;
+  }
+  server {
+    listen 8443 ssl;
+    server_name api.example.com;
+    ssl_certificate `+apiCert+`;
+  }
+  server {
+    listen 9443 ssl;
+    ssl_certificate /etc/nginx/ssl/$ssl_server_name.crt;
+  }
+  server {
+    listen 80;
+    server_name _;
+  }
+  server {
+    listen 8080;
+    server_name default.example.com;
+    ssl on;
+  }
+  server {
+    listen unix:/run/nginx.sock ssl;
+  }
+}
+`), 0600))
+
+	inst := &instance{args: argumentList{StatusURL: "http://localhost/status", ConfigPath: configPath, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	require.NoError(t, inst.setInventoryData(e.Inventory))
+
+	directives, confPrefix, err := inst.loadConfig()
+	require.NoError(t, err)
+	certificates := loadCertificates(directives, confPrefix)
+	require.Len(t, certificates, 3)
+	assert.Equal(t, defaultCert, certificates[0].path, "relative paths are resolved from the configuration prefix")
+	assert.Equal(t, []string{"www.example.com", "default.example.com", "unix:/run/nginx.sock"}, certificates[0].servers,
+		"TLS servers inherit the http certificate")
+
+	items := e.Inventory.Items()
+	item := items["certificates/www.example.com/"+strings.Replace(defaultCert, "/", ":", -1)]
+	require.NotNil(t, item)
+	assert.Equal(t, "CN=default.example.com", item["subject"])
+	assert.Equal(t, "default.example.com", item["sans"])
+	assert.Equal(t, "CN=default.example.com", item["issuer"])
+	assert.Equal(t, certificates[0].chain[0].SerialNumber.Text(16), item["serial"])
+	assert.Equal(t, 1, item["chainLength"])
+	assert.NotEmpty(t, item["notAfter"])
+
+	assert.Contains(t, items, "certificates/unix::run:nginx.sock/"+strings.Replace(defaultCert, "/", ":", -1),
+		"slashes in server addresses don't nest the key")
+
+	item = items["certificates/9443/:etc:nginx:ssl:$ssl_server_name.crt"]
+	require.NotNil(t, item)
+	assert.Equal(t, errUnresolvableCertificate.Error(), item["error"])
+
+	require.NoError(t, inst.populateCertificateSamples(e))
+	require.Len(t, e.Metrics, 3)
+	days := e.Metrics[0].Metrics["certificate.daysUntilExpiry"].(float64)
+	assert.InDelta(t, 10, days, 0.1)
+	assert.Equal(t, "www.example.com,default.example.com,unix:/run/nginx.sock", e.Metrics[0].Metrics["certificate.servers"])
+	assert.Less(t, e.Metrics[1].Metrics["certificate.daysUntilExpiry"], float64(0), "expired certificates")
+	assert.Equal(t, apiCert, e.Metrics[1].Metrics["certificate.path"])
+	assert.NotContains(t, e.Metrics[2].Metrics, "certificate.daysUntilExpiry")
+	assert.Equal(t, errUnresolvableCertificate.Error(), e.Metrics[2].Metrics["certificate.error"])
+
+	// The samples are reported by the metrics, as the inventory may be collected by a separate job.
+	inst = &instance{args: argumentList{
+		DefaultArgumentList: sdk_args.DefaultArgumentList{Metrics: true},
+		StatusURL:           "http://127.0.0.1:0/status",
+		ConfigPath:          configPath,
+		RemoteMonitoring:    true,
+	}}
+	i, err = integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	assert.Error(t, inst.collect(i))
+	e, err = inst.entity(i)
+	require.NoError(t, err)
+	assert.NotNil(t, findMetricSet(e, certificateEventType, map[string]string{"certificate.path": defaultCert}))
+}
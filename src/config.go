@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errMissingClosingBracket    = fmt.Errorf("missing closing bracket")
+	errUnexpectedClosingBracket = fmt.Errorf("unexpected closing bracket")
+)
+
+const includeDirective = "include"
+
+// regexQuantifier matches the rest of a regular expression quantifier after its opening brace, e.g. "2}" or "1,3}".
+var regexQuantifier = regexp.MustCompile(`^\d+(,\d*)?}`)
+
+// configToken is a token of NGINX configuration: a word, a quoted string or one of the ; { } delimiters.
+type configToken struct {
+	// value is the token with its quotes removed and its escape sequences replaced, as NGINX reads it.
+	value string
+	// raw is the token as written in the configuration.
+	raw    string
+	line   int
+	quoted bool
+}
+
+// isDelimiter is true for the unquoted ; { and } tokens.
+func (t configToken) isDelimiter(delimiter string) bool {
+	return !t.quoted && t.raw == delimiter
+}
+
+// configTokenizer splits NGINX configuration into tokens following the NGINX lexing rules: tokens are separated by
+// whitespace and the ; { } delimiters, comments start with #, single and double quotes enclose strings with any of
+// them, and backslashes escape the next character. A brace doesn't end a word when it's part of a ${variable} or, to
+// accept unquoted regular expressions, of a quantifier like {2}.
+type configTokenizer struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newConfigTokenizer(reader io.Reader) *configTokenizer {
+	return &configTokenizer{reader: bufio.NewReader(reader), line: 1}
+}
+
+func (t *configTokenizer) readRune() (rune, error) {
+	r, _, err := t.reader.ReadRune()
+	if err == nil && r == '\n' {
+		t.line++
+	}
+	return r, err
+}
+
+func (t *configTokenizer) unreadRune(r rune) {
+	if r == '\n' {
+		t.line--
+	}
+	_ = t.reader.UnreadRune()
+}
+
+// next returns the next token, or io.EOF at the end of the configuration.
+func (t *configTokenizer) next() (configToken, error) {
+	for {
+		r, err := t.readRune()
+		if err != nil {
+			return configToken{}, err
+		}
+
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '#':
+			for r != '\n' {
+				if r, err = t.readRune(); err != nil {
+					return configToken{}, err
+				}
+			}
+			continue
+		case ';', '{', '}':
+			return configToken{value: string(r), raw: string(r), line: t.line}, nil
+		case '"', '\'':
+			return t.quoted(r)
+		default:
+			t.unreadRune(r)
+			return t.word()
+		}
+	}
+}
+
+// quoted reads a string enclosed in the quote, which must be followed by whitespace, a delimiter or a closing
+// parenthesis, as in if ($request_method = "POST").
+func (t *configTokenizer) quoted(quote rune) (configToken, error) {
+	token := configToken{line: t.line, quoted: true}
+	var raw strings.Builder
+	raw.WriteRune(quote)
+	for {
+		r, err := t.readRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return token, fmt.Errorf("at line %d: unexpected end of file, expecting %c", token.line, quote)
+			}
+			return token, err
+		}
+		raw.WriteRune(r)
+		if r == '\\' {
+			escaped, err := t.readRune()
+			if err != nil {
+				return token, fmt.Errorf("at line %d: unexpected end of file, expecting %c", token.line, quote)
+			}
+			raw.WriteRune(escaped)
+			continue
+		}
+		if r == quote {
+			break
+		}
+	}
+	token.raw = raw.String()
+	token.value = unescapeConfigToken(token.raw[1 : len(token.raw)-1])
+
+	r, err := t.readRune()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return token, nil
+		}
+		return token, err
+	}
+	switch r {
+	case ' ', '\t', '\r', '\n', ';', '{', '}', ')':
+		t.unreadRune(r)
+		return token, nil
+	default:
+		return token, fmt.Errorf("at line %d: unexpected \"%c\" after %s", t.line, r, token.raw)
+	}
+}
+
+// word reads an unquoted token.
+func (t *configTokenizer) word() (configToken, error) {
+	token := configToken{line: t.line}
+	var raw strings.Builder
+	for {
+		r, err := t.readRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return token, err
+		}
+
+		if r == '\\' {
+			raw.WriteRune(r)
+			if r, err = t.readRune(); err != nil {
+				break
+			}
+			raw.WriteRune(r)
+			continue
+		}
+		if r == '{' && t.braceInWord(raw.String()) {
+			raw.WriteRune(r)
+			continue
+		}
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ';' || r == '{' {
+			t.unreadRune(r)
+			break
+		}
+		raw.WriteRune(r)
+	}
+	token.raw = raw.String()
+	token.value = unescapeConfigToken(token.raw)
+	return token, nil
+}
+
+// braceInWord is true when an opening brace after the word read so far is part of it.
+func (t *configTokenizer) braceInWord(word string) bool {
+	if strings.HasSuffix(word, "$") && !strings.HasSuffix(word, `\$`) {
+		return true
+	}
+	if word == "" {
+		return false
+	}
+	next, _ := t.reader.Peek(16)
+	return regexQuantifier.Match(next)
+}
+
+// unescapeConfigToken replaces the escape sequences NGINX replaces in tokens. Other backslashes are kept, as they're
+// meaningful in regular expressions.
+func unescapeConfigToken(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '"', '\'', '\\':
+				unescaped.WriteByte(s[i+1])
+				i++
+				continue
+			case 't':
+				unescaped.WriteByte('\t')
+				i++
+				continue
+			case 'r':
+				unescaped.WriteByte('\r')
+				i++
+				continue
+			case 'n':
+				unescaped.WriteByte('\n')
+				i++
+				continue
+			}
+		}
+		unescaped.WriteByte(s[i])
+	}
+	return unescaped.String()
+}
+
+// configDirective is a directive of NGINX configuration, with the directives in its block if it has one.
+type configDirective struct {
+	name string
+	args []string
+	// rawArgs are the arguments as written in the configuration, with their quotes.
+	rawArgs []string
+	// block is nil for simple directives and non-nil, although it may be empty, for block directives.
+	block []*configDirective
+	// file is the configuration file the directive is in, when read from a file.
+	file string
+	line int
+}
+
+// rawValue returns the arguments of the directive as written in the configuration.
+func (d *configDirective) rawValue() string {
+	return strings.Join(d.rawArgs, " ")
+}
+
+// isBlock is true for directives with a block, like http or server.
+func (d *configDirective) isBlock() bool {
+	return d.block != nil
+}
+
+// parseConfig parses the NGINX configuration into its directives. include directives aren't followed.
+func parseConfig(reader io.Reader) ([]*configDirective, error) {
+	return (&configLoader{}).parse(reader, "")
+}
+
+// configLoader parses NGINX configuration files, replacing include directives with the directives of the files they
+// include, so they're in the block they were included into.
+type configLoader struct {
+	files configFiles
+	// confPrefix is the directory relative include paths are resolved from, as NGINX does with its configuration
+	// prefix. Included files are only loaded when files is set.
+	confPrefix string
+	// including are the files being parsed, from the main configuration file to the innermost include, to detect
+	// include loops.
+	including []string
+}
+
+// loadConfigFile parses the configuration file and the files it includes.
+func loadConfigFile(files configFiles, configPath string) ([]*configDirective, error) {
+	loader := &configLoader{files: files, confPrefix: filepath.Dir(configPath)}
+	return loader.loadFile(configPath)
+}
+
+func (l *configLoader) loadFile(path string) ([]*configDirective, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, including := range l.including {
+		if including == absPath {
+			return nil, errors.Errorf("include loop in nginx config file '%s'", path)
+		}
+	}
+	l.including = append(l.including, absPath)
+	defer func() {
+		l.including = l.including[:len(l.including)-1]
+	}()
+
+	f, err := l.files.open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open nginx config file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	directives, err := l.parse(f, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing nginx config file '%s': %w", path, err)
+	}
+	return directives, nil
+}
+
+// include loads the files matching the pattern of an include directive.
+func (l *configLoader) include(pattern string) ([]*configDirective, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(l.confPrefix, pattern)
+	}
+	paths, err := l.files.glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include '%s': %w", pattern, err)
+	}
+	if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		// As NGINX does, an include without wildcards must exist.
+		return nil, errors.Errorf("included nginx config file '%s' not found", pattern)
+	}
+
+	var directives []*configDirective
+	for _, path := range paths {
+		included, err := l.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, included...)
+	}
+	return directives, nil
+}
+
+// parse reads the directives of a file. The include directives are kept, followed by the directives they include.
+func (l *configLoader) parse(reader io.Reader, file string) ([]*configDirective, error) {
+	tokenizer := newConfigTokenizer(reader)
+
+	// blocks are the directive lists being filled, from the main context to the innermost open block.
+	blocks := []*[]*configDirective{new([]*configDirective)}
+	var current *configDirective
+	for {
+		token, err := tokenizer.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		block := blocks[len(blocks)-1]
+		switch {
+		case token.isDelimiter(";"):
+			if current == nil {
+				return nil, fmt.Errorf("at line %d: unexpected \";\"", token.line)
+			}
+			*block = append(*block, current)
+			if current.name == includeDirective && l.files != nil && len(current.args) > 0 {
+				included, err := l.include(current.args[0])
+				if err != nil {
+					return nil, fmt.Errorf("at line %d: %w", current.line, err)
+				}
+				*block = append(*block, included...)
+			}
+			current = nil
+		case token.isDelimiter("{"):
+			if current == nil {
+				return nil, fmt.Errorf("at line %d: unexpected \"{\"", token.line)
+			}
+			current.block = []*configDirective{}
+			*block = append(*block, current)
+			blocks = append(blocks, &current.block)
+			current = nil
+		case token.isDelimiter("}"):
+			if current != nil {
+				return nil, fmt.Errorf("at line %d: unexpected \"}\"", token.line)
+			}
+			if len(blocks) == 1 {
+				return nil, fmt.Errorf("at line %d: %w", token.line, errUnexpectedClosingBracket)
+			}
+			blocks = blocks[:len(blocks)-1]
+		case current == nil:
+			current = &configDirective{name: token.value, file: file, line: token.line}
+		default:
+			current.args = append(current.args, token.value)
+			current.rawArgs = append(current.rawArgs, token.raw)
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("at line %d: unexpected end of file, expecting \";\" or \"}\"", current.line)
+	}
+	if len(blocks) > 1 {
+		return nil, fmt.Errorf("at line %d: %w", tokenizer.line, errMissingClosingBracket)
+	}
+	return *blocks[0], nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigTokenizer(t *testing.T) {
+	config := `add_header X-Test "a;b" always; # comment ; {
+return 200 '#ok';
+location ~ ^/(a|b){2}$ {
+  set $x "${host}\"q\"";
+  if ($request_method = "POST") {
+    rewrite ^/old/(.*)$ /new/$1\.html break;
+  }
+}`
+	tokenizer := newConfigTokenizer(strings.NewReader(config))
+	var values, raws []string
+	for {
+		token, err := tokenizer.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		values = append(values, token.value)
+		raws = append(raws, token.raw)
+	}
+
+	assert.Equal(t, []string{
+		"add_header", "X-Test", "a;b", "always", ";",
+		"return", "200", "#ok", ";",
+		"location", "~", "^/(a|b){2}$", "{",
+		"set", "$x", `${host}"q"`, ";",
+		"if", "($request_method", "=", "POST", ")", "{",
+		"rewrite", "^/old/(.*)$", `/new/$1\.html`, "break", ";",
+		"}",
+		"}",
+	}, values)
+	assert.Equal(t, `"a;b"`, raws[2])
+	assert.Equal(t, `"${host}\"q\""`, raws[15])
+	assert.Equal(t, 8, tokenizer.line)
+}
+
+func TestParseConfig(t *testing.T) {
+	directives, err := parseConfig(strings.NewReader(`
+events {}
+http {
+  server {
+    listen 443 ssl;
+    location ~ "^/api/v[0-9]{1,2}/" {
+      proxy_pass http://backend;
+    }
+  }
+}`))
+	require.NoError(t, err)
+	require.Len(t, directives, 2)
+
+	assert.Equal(t, "events", directives[0].name)
+	assert.True(t, directives[0].isBlock())
+	assert.Empty(t, directives[0].block)
+
+	server := directives[1].block[0]
+	assert.Equal(t, "server", server.name)
+	assert.Equal(t, []string{"443", "ssl"}, server.block[0].args)
+	assert.Equal(t, 5, server.block[0].line)
+
+	location := server.block[1]
+	assert.Equal(t, []string{"~", "^/api/v[0-9]{1,2}/"}, location.args)
+	assert.Equal(t, `~ "^/api/v[0-9]{1,2}/"`, location.rawValue())
+	assert.False(t, location.block[0].isBlock())
+
+	for _, invalid := range []string{
+		"http {",
+		"}",
+		"user nginx",
+		"user ;;",
+		`return 200 "unterminated;`,
+		`add_header X "a"b;`,
+	} {
+		_, err := parseConfig(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
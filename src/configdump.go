@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	inventorySourceConfigFile = "config_file"
+	inventorySourceNginxT     = "nginx_t"
+
+	// configDumpStdin as the config dump file reads the nginx -T output from the standard input.
+	configDumpStdin = "-"
+
+	configDumpFilePrefix = "# configuration file "
+	configDumpTimeout    = 30 * time.Second
+)
+
+// configDump are the configuration files printed by nginx -T, which NGINX loaded, in the order they were printed.
+type configDump struct {
+	paths    []string
+	contents map[string][]byte
+}
+
+func (d *configDump) open(path string) (io.ReadCloser, error) {
+	content, ok := d.contents[path]
+	if !ok {
+		return nil, errors.New("file not found in nginx -T output")
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (d *configDump) glob(pattern string) ([]string, error) {
+	var paths []string
+	for _, path := range d.paths {
+		match, err := filepath.Match(pattern, path)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			paths = append(paths, path)
+		}
+	}
+	// NGINX includes the files matching a pattern in alphabetical order, as filepath.Glob returns them.
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readConfigDump returns the configuration NGINX loaded, from the file with the output of nginx -T or by running the
+// NGINX binary with the configuration file of the instance, and its prefix when set.
+func (inst *instance) readConfigDump() (*configDump, error) {
+	var output []byte
+	var err error
+	switch inst.args.ConfigDumpFile {
+	case "":
+		ctx, cancel := context.WithTimeout(context.Background(), configDumpTimeout)
+		defer cancel()
+
+		nginxArgs := []string{"-T", "-c", inst.args.ConfigPath}
+		if inst.args.NginxPrefix != "" {
+			nginxArgs = append(nginxArgs, "-p", inst.args.NginxPrefix)
+		}
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, inst.args.NginxBinary, nginxArgs...)
+		cmd.Stderr = &stderr
+		output, err = cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("running '%s %s': %w: %s", inst.args.NginxBinary, strings.Join(nginxArgs, " "), err,
+				strings.TrimSpace(stderr.String()))
+		}
+	case configDumpStdin:
+		output, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading nginx -T output from the standard input: %w", err)
+		}
+	default:
+		output, err = os.ReadFile(inst.args.ConfigDumpFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read nginx -T output file '%s': %w", inst.args.ConfigDumpFile, err)
+		}
+	}
+	return parseConfigDump(output)
+}
+
+// parseConfigDump splits the output of nginx -T into the files it prints, each one after a
+// "# configuration file <path>:" line. The first one is the main configuration file.
+func parseConfigDump(output []byte) (*configDump, error) {
+	dump := &configDump{contents: make(map[string][]byte)}
+
+	var current string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, configDumpFilePrefix) && strings.HasSuffix(line, ":") {
+			current = strings.TrimSuffix(strings.TrimPrefix(line, configDumpFilePrefix), ":")
+			if _, ok := dump.contents[current]; !ok {
+				dump.paths = append(dump.paths, current)
+			}
+			dump.contents[current] = nil
+			continue
+		}
+		if current != "" {
+			dump.contents[current] = append(append(dump.contents[current], line...), '\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading nginx -T output: %w", err)
+	}
+
+	if len(dump.paths) == 0 {
+		return nil, errors.New("no configuration file found in nginx -T output")
+	}
+	return dump, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfigDump = `# configuration file /etc/nginx/nginx.conf:
+user nginx;
+events {
+  worker_connections 1024;
+}
+http {
+  include /etc/nginx/conf.d/*.conf;
+}
+
+# configuration file /etc/nginx/conf.d/default.conf:
+server {
+  listen 80;
+  server_name example.com;
+}
+
+`
+
+func TestParseConfigDump(t *testing.T) {
+	dump, err := parseConfigDump([]byte("nginx: the configuration file /etc/nginx/nginx.conf syntax is ok\n" + testConfigDump))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d/default.conf"}, dump.paths)
+	assert.Contains(t, string(dump.contents["/etc/nginx/conf.d/default.conf"]), "server_name example.com;")
+
+	paths, err := dump.glob("/etc/nginx/conf.d/*.conf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/etc/nginx/conf.d/default.conf"}, paths)
+
+	_, err = parseConfigDump([]byte("nginx: [emerg] unknown directive \"foo\"\n"))
+	assert.Error(t, err)
+}
+
+func TestPopulateInventoryDump(t *testing.T) {
+	dump, err := parseConfigDump([]byte(testConfigDump))
+	require.NoError(t, err)
+
+	directives, err := loadConfigFile(dump, dump.paths[0])
+	require.NoError(t, err)
+	redactor, err := newConfigRedactor(nil, "", "")
+	require.NoError(t, err)
+	i := inventory.New()
+	require.NoError(t, addInventoryItems(i, directives, redactor))
+	assert.Equal(t, "nginx", i.Items()["user"]["value"])
+	assert.Equal(t, "/etc/nginx/nginx.conf", i.Items()["user"]["source"])
+	assert.Equal(t, "example.com", i.Items()["http/server/server_name"]["value"])
+	assert.Equal(t, "/etc/nginx/conf.d/default.conf", i.Items()["http/server/server_name"]["source"])
+}
+
+func TestReadConfigDump(t *testing.T) {
+	dir := t.TempDir()
+	dumpFile := filepath.Join(dir, "nginx-T.out")
+	require.NoError(t, os.WriteFile(dumpFile, []byte(testConfigDump), 0600))
+
+	inst := &instance{args: argumentList{InventorySource: inventorySourceNginxT, ConfigDumpFile: dumpFile}}
+	i := inventory.New()
+	require.NoError(t, inst.setInventoryData(i))
+	assert.Equal(t, "80", i.Items()["http/server/listen"]["value"])
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake NGINX binary is a shell script")
+	}
+	binary := filepath.Join(dir, "nginx")
+	script := "#!/bin/sh\n[ \"$*\" = \"-T -c /opt/nginx/nginx.conf -p /opt/nginx\" ] || exit 1\ncat " + dumpFile + "\n"
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0700))
+	inst = &instance{args: argumentList{
+		InventorySource: inventorySourceNginxT,
+		NginxBinary:     binary,
+		ConfigPath:      "/opt/nginx/nginx.conf",
+		NginxPrefix:     "/opt/nginx",
+	}}
+	dump, err := inst.readConfigDump()
+	require.NoError(t, err, "NGINX is run with the configuration file and prefix of the instance")
+	assert.Len(t, dump.paths, 2)
+
+	inst.args.NginxBinary = filepath.Join(dir, "missing")
+	_, err = inst.readConfigDump()
+	assert.Error(t, err)
+}
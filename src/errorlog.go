@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/event"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	errorLogStateKey = "errorLog"
+
+	errorLogEventCategory = "NginxErrorLog"
+
+	// maxErrorLogEvents limits the events reported per execution when NGINX floods the error log.
+	maxErrorLogEvents = 20
+)
+
+var errorLogDefinition = map[string][]interface{}{
+	"errorLog.emergPerSecond": {"emerg", metric.PRATE},
+	"errorLog.alertPerSecond": {"alert", metric.PRATE},
+	"errorLog.critPerSecond":  {"crit", metric.PRATE},
+	"errorLog.errorPerSecond": {"error", metric.PRATE},
+	"errorLog.warnPerSecond":  {"warn", metric.PRATE},
+}
+
+// errorLogLevels are the levels counted in the state of the error log, from the most to the least severe.
+var errorLogLevels = []string{"emerg", "alert", "crit", "error", "warn"}
+
+// errorLogEventLevels and errorLogEventMessages select the lines reported as events.
+var (
+	errorLogEventLevels   = map[string]bool{"emerg": true, "alert": true}
+	errorLogEventMessages = []string{"upstream timed out", "no live upstreams"}
+)
+
+// errorLogLine matches lines like "2026/10/18 10:00:00 [error] 31#31: *5 upstream timed out ...".
+var errorLogLine = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] \d+#\d+: (?:\*\d+ )?(.*)$`)
+
+// errorLogEntry is an error log line reported as an event.
+type errorLogEntry struct {
+	time    string
+	level   string
+	message string
+}
+
+// errorLogPath returns the error log from the main context of the configuration file, relative to nginxPrefix, unless
+// pathOverride is set.
+func errorLogPath(configPath, nginxPrefix, pathOverride string) (string, error) {
+	if pathOverride != "" {
+		return pathOverride, nil
+	}
+
+	directives, err := configDirectives(configPath)
+	if err != nil {
+		return "", err
+	}
+	errorLogs := directives["error_log"]
+	if len(errorLogs) == 0 || len(errorLogs[0].args) == 0 {
+		return "", errors.Errorf("no error_log found in nginx config file '%s'", configPath)
+	}
+	return logFilePath("error_log", errorLogs[0].args[0], configPath, nginxPrefix)
+}
+
+// getErrorLogMetrics reads the error log lines appended since the previous execution, reports the rate of lines per
+// level and adds an event to the entity for the most severe ones.
+func (inst *instance) getErrorLogMetrics(e *integration.Entity, sample *metric.Set) error {
+	store := inst.store
+	if store == nil {
+		return errors.New("error log metrics require a state store")
+	}
+
+	path, err := errorLogPath(inst.args.ConfigPath, inst.args.NginxPrefix, inst.args.ErrorLogPath)
+	if err != nil {
+		return err
+	}
+
+	var entries []errorLogEntry
+	var counters map[string]float64
+	err = updateLogState(store, errorLogStateKey, errorLogLevels, func(state *logState, firstRead bool) error {
+		entries, err = readErrorLog(path, state, firstRead)
+		counters = state.Counters
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if i == maxErrorLogEvents {
+			log.Warn("Skipped %d error log events over the limit of %d", len(entries)-maxErrorLogEvents, maxErrorLogEvents)
+			break
+		}
+		err := e.AddEvent(event.NewWithAttributes(entry.message, errorLogEventCategory, map[string]interface{}{
+			"level":   entry.level,
+			"time":    entry.time,
+			"logFile": path,
+		}))
+		if err != nil {
+			log.Warn("Unable to add event: %s", err)
+		}
+	}
+
+	rawMetrics := make(map[string]interface{}, len(counters))
+	for level, value := range counters {
+		rawMetrics[level] = value
+	}
+	return populateMetrics(sample, rawMetrics, errorLogDefinition)
+}
+
+// readErrorLog reads the lines appended to the error log since the cursor in the state, updating its counters. It
+// returns the lines to be reported as events.
+func readErrorLog(path string, state *logState, firstRead bool) ([]errorLogEntry, error) {
+	var entries []errorLogEntry
+	err := tailLog(path, &state.logCursor, firstRead, func(line string) {
+		match := errorLogLine.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if match == nil {
+			return
+		}
+		entry := errorLogEntry{time: match[1], level: match[2], message: match[3]}
+		if _, ok := state.Counters[entry.level]; !ok {
+			return
+		}
+		state.Counters[entry.level]++
+
+		if errorLogEventLevels[entry.level] || containsAny(entry.message, errorLogEventMessages) {
+			entries = append(entries, entry)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading nginx error log: %w", err)
+	}
+	return entries, nil
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
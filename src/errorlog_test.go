@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testErrorLogLines = `2026/10/18 10:00:00 [notice] 1#1: signal process started
+2026/10/18 10:00:01 [warn] 31#31: *7 an upstream response is buffered to a temporary file
+2026/10/18 10:00:02 [error] 31#31: *8 upstream timed out (110: Connection timed out) while reading response header from upstream
+2026/10/18 10:00:03 [error] 31#31: *9 open() "/usr/share/nginx/html/favicon.ico" failed (2: No such file or directory)
+2026/10/18 10:00:04 [emerg] 1#1: bind() to 0.0.0.0:80 failed (98: Address already in use)
+`
+
+func TestErrorLogPath(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	path, err := errorLogPath(configPath, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/nginx/error.log", path)
+
+	path, err = errorLogPath(configPath, "", "/tmp/error.log")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/error.log", path)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`error_log "/var/log/e.log" warn;`), 0600))
+	path, err = errorLogPath(configPath, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/e.log", path)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("error_log syslog:server=unix:/dev/log;\n"), 0600))
+	_, err = errorLogPath(configPath, "", "")
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("error_log logs/error.log;\n"), 0600))
+	path, err = errorLogPath(configPath, "/usr/local/nginx", "")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/usr/local/nginx", "logs/error.log"), path)
+	_, err = errorLogPath(configPath, "", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ERROR_LOG_PATH")
+}
+
+func TestGetErrorLogMetrics(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "error.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(testErrorLogLines), 0600))
+
+	inst := &instance{args: argumentList{StatusURL: "http://localhost/status", ErrorLogPath: logPath}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	ms := inst.metricSet(e, "NginxSample", false)
+	store := persist.NewInMemoryStore()
+	inst.store = store
+
+	require.NoError(t, inst.getErrorLogMetrics(e, ms))
+	assert.Empty(t, e.Events, "existing lines are skipped on the first read")
+	assert.Equal(t, float64(0), ms.Metrics["errorLog.errorPerSecond"])
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(testErrorLogLines)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	var state logState
+	_, err = store.Get(errorLogStateKey, &state)
+	require.NoError(t, err)
+	entries, err := readErrorLog(logPath, &state, false)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), state.Counters["warn"])
+	assert.Equal(t, float64(2), state.Counters["error"])
+	assert.Equal(t, float64(1), state.Counters["emerg"])
+	assert.NotContains(t, state.Counters, "notice")
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, "error", entries[0].level)
+	assert.Contains(t, entries[0].message, "upstream timed out")
+	assert.Equal(t, "emerg", entries[1].level)
+	assert.Equal(t, "2026/10/18 10:00:04", entries[1].time)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// fileInode isn't available on Windows, where log rotation is only detected when the file is truncated.
+func fileInode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/log"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/pkg/errors"
+)
+
+// instance is an NGINX instance monitored by the integration, reported as its own entity.
+type instance struct {
+	args argumentList
+	// labels are added as label.<name> attributes to the samples and events of the instance.
+	labels map[string]string
+	// store keeps the state of the monitored objects between executions, e.g. to report upstream peer state changes.
+	// It's nil when the store couldn't be created.
+	store persist.Storer
+	// redactionKey is the HMAC key of the values redacted from the inventory, shared by the instances of the
+	// installation.
+	redactionKey []byte
+	// client, tlsConfig and header connect to the status endpoint, created on the first request.
+	client    *http.Client
+	tlsConfig *tls.Config
+	header    http.Header
+	// scrapeErrors are the failures of the collection that didn't prevent reporting the rest of the data.
+	scrapeErrors []scrapeError
+	// scrapeDuration, statusModule and statusRequests describe how the metrics were collected, for the scrape metrics.
+	scrapeDuration time.Duration
+	statusModule   string
+	statusRequests []statusRequest
+	// statusTLS is the TLS connection to the status URL, when it's HTTPS.
+	statusTLS *statusTLS
+}
+
+// statusRequest is a request to the status endpoint that got a response.
+type statusRequest struct {
+	path       string
+	duration   time.Duration
+	statusCode int
+	size       int
+}
+
+// scrapeError is a failure of a stage of the collection of an instance.
+type scrapeError struct {
+	stage string
+	err   error
+}
+
+// Stages of the collection of an instance, which identify the failures reported in the nginx.scrape.error attribute.
+const (
+	stageInventory = "inventory"
+	stageMetrics   = "metrics"
+	stageAccessLog = "accessLog"
+	stageErrorLog  = "errorLog"
+)
+
+// instanceConfig is an element of the instances argument.
+type instanceConfig struct {
+	StatusURL    string            `json:"status_url"`
+	StatusModule string            `json:"status_module"`
+	ConfigPath   string            `json:"config_path"`
+	Labels       map[string]string `json:"labels"`
+}
+
+// newInstances returns the instances set in the instances argument, which override the status URL, status module and
+// configuration file of the integration arguments. Without instances, the integration arguments are the only instance.
+func newInstances(args argumentList) ([]*instance, error) {
+	if args.Instances == "" {
+		return []*instance{{args: args}}, nil
+	}
+
+	var configs []instanceConfig
+	if err := json.Unmarshal([]byte(args.Instances), &configs); err != nil {
+		return nil, fmt.Errorf("instances must be a JSON list of objects: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("instances is an empty list")
+	}
+	if args.ConfigDumpFile == configDumpStdin {
+		// The standard input can only be read once, and has the configuration of a single NGINX.
+		return nil, errors.New("the nginx -T output can't be read from the standard input with instances")
+	}
+
+	instances := make([]*instance, 0, len(configs))
+	entities := make(map[string]bool, len(configs))
+	for n, config := range configs {
+		if config.StatusURL == "" {
+			return nil, errors.Errorf("instance %d has no status_url", n)
+		}
+		hostname, port, err := parseStatusURL(config.StatusURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status_url '%s': %w", config.StatusURL, err)
+		}
+		// Instances are reported as remote entities, named after the host and port of their status URL.
+		entityName := fmt.Sprintf("%s:%s", hostname, port)
+		if entities[entityName] {
+			return nil, errors.Errorf("more than one instance has the host and port %s", entityName)
+		}
+		entities[entityName] = true
+
+		inst := &instance{args: args, labels: config.Labels}
+		inst.args.Instances = ""
+		inst.args.RemoteMonitoring = true
+		inst.args.StatusURL = config.StatusURL
+		if config.StatusModule != "" {
+			inst.args.StatusModule = config.StatusModule
+		}
+		if config.ConfigPath != "" {
+			inst.args.ConfigPath = config.ConfigPath
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// collectInstances collects the data of the instances concurrently, at most maxConcurrent at the same time. It returns
+// the error of each instance from which nothing could be collected, so a failing instance doesn't prevent reporting the
+// others.
+func collectInstances(i *integration.Integration, instances []*instance, maxConcurrent int) []error {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	errs := make([]error, len(instances))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxConcurrent && w < len(instances); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				errs[n] = instances[n].collect(i)
+			}
+		}()
+	}
+	for n := range instances {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// collect adds the inventory, metrics and events of the instance to its entity. A failing stage doesn't prevent the
+// others from being collected; the failures are reported in the scrape metrics of the instance sample. An error is
+// only returned when nothing could be collected.
+func (inst *instance) collect(i *integration.Integration) error {
+	e, err := inst.entity(i)
+	if err != nil {
+		return err
+	}
+
+	labels := make([]string, 0, len(inst.labels))
+	for name := range inst.labels {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+	for _, name := range labels {
+		e.AddAttributes(attribute.Attr("label."+name, inst.labels[name]))
+	}
+
+	collected := false
+	if inst.args.HasInventory() {
+		if err := inst.setInventoryData(e.Inventory); err != nil {
+			inst.scrapeFailed(stageInventory, err)
+		} else {
+			collected = true
+		}
+	}
+
+	if inst.args.HasMetrics() {
+		inst.store, err = inst.newStateStore(i)
+		if err != nil {
+			log.Warn("Unable to create state store, upstream peer state changes and log metrics won't be reported: %s", err)
+		}
+
+		ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+		if err := inst.getMetricsData(e, ms); err != nil {
+			inst.scrapeFailed(stageMetrics, err)
+		} else {
+			collected = true
+		}
+
+		if inst.args.AccessLogMetrics {
+			if err := inst.getAccessLogMetrics(ms); err != nil {
+				inst.scrapeFailed(stageAccessLog, err)
+			}
+		}
+		if inst.args.ErrorLogMetrics {
+			if err := inst.getErrorLogMetrics(e, ms); err != nil {
+				inst.scrapeFailed(stageErrorLog, err)
+			}
+		}
+		if err := inst.populateCertificateSamples(e); err != nil {
+			log.Warn("Unable to read the certificates of nginx config file '%s', their samples won't be reported: %s",
+				inst.args.ConfigPath, err)
+		}
+		inst.populateScrapeMetrics(ms)
+		inst.populateStatusTLSMetrics(ms)
+	}
+
+	if !collected {
+		return errors.New(inst.scrapeErrorMessage())
+	}
+	return nil
+}
+
+// scrapeFailed records the failure of a stage of the collection.
+func (inst *instance) scrapeFailed(stage string, err error) {
+	log.Warn("Unable to collect %s from %s: %s", stage, inst.args.StatusURL, err)
+	inst.scrapeErrors = append(inst.scrapeErrors, scrapeError{stage: stage, err: err})
+}
+
+// scrapeErrorMessage describes the failures of the collection, e.g. "metrics: connection refused".
+func (inst *instance) scrapeErrorMessage() string {
+	messages := make([]string, 0, len(inst.scrapeErrors))
+	for _, scrapeErr := range inst.scrapeErrors {
+		messages = append(messages, fmt.Sprintf("%s: %s", scrapeErr.stage, scrapeErr.err))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// populateScrapeMetrics reports whether the collection succeeded, the failures when it didn't, and the duration, status
+// code and size of every request to the status endpoint, so that a missing metric can be told apart from an
+// unreachable or slow instance. The requests are reported per endpoint, e.g. integration.http.upstreams.httpStatusCode,
+// and the request to the status URL itself as integration.status.httpStatusCode.
+func (inst *instance) populateScrapeMetrics(sample *metric.Set) {
+	success := 1
+	if len(inst.scrapeErrors) > 0 {
+		success = 0
+	}
+
+	rawMetrics := map[string]interface{}{
+		"nginx.scrape.error":               inst.scrapeErrorMessage(),
+		"nginx.scrape.success":             success,
+		"nginx.scrape.errors":              len(inst.scrapeErrors),
+		"integration.scrapeDurationMs":     durationMs(inst.scrapeDuration),
+		"integration.statusModuleDetected": inst.statusModule,
+	}
+	for _, req := range inst.statusRequests {
+		prefix := "integration." + pathToPrefix(req.path)
+		if req.path == "" {
+			prefix = "integration.status."
+		}
+		rawMetrics[prefix+"requestDurationMs"] = durationMs(req.duration)
+		rawMetrics[prefix+"httpStatusCode"] = req.statusCode
+		rawMetrics[prefix+"responseSizeBytes"] = req.size
+	}
+
+	setRawMetrics(sample, rawMetrics)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// uniqueID identifies the instance arguments across executions.
+func (inst *instance) uniqueID() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%v", inst.args))))
+}
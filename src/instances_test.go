@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk_args "github.com/newrelic/infra-integrations-sdk/v3/args"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstances(t *testing.T) {
+	args := argumentList{StatusURL: "http://127.0.0.1/status", StatusModule: "discover", ConfigPath: "/etc/nginx/nginx.conf", Username: "nri"}
+
+	instances, err := newInstances(args)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, args, instances[0].args)
+
+	args.Instances = `[
+		{"status_url": "http://10.0.0.1/status", "labels": {"role": "edge"}},
+		{"status_url": "https://10.0.0.2:8443/api/9", "status_module": "ngx_http_api_module", "config_path": "/opt/nginx/nginx.conf"}
+	]`
+	instances, err = newInstances(args)
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+
+	assert.Equal(t, "http://10.0.0.1/status", instances[0].args.StatusURL)
+	assert.Equal(t, "discover", instances[0].args.StatusModule)
+	assert.Equal(t, "/etc/nginx/nginx.conf", instances[0].args.ConfigPath)
+	assert.Equal(t, map[string]string{"role": "edge"}, instances[0].labels)
+	assert.True(t, instances[0].args.RemoteMonitoring)
+	assert.Equal(t, "nri", instances[0].args.Username, "the rest of the arguments are shared")
+
+	assert.Equal(t, httpAPIStatus, instances[1].args.StatusModule)
+	assert.Equal(t, "/opt/nginx/nginx.conf", instances[1].args.ConfigPath)
+	assert.NotEqual(t, instances[0].uniqueID(), instances[1].uniqueID())
+
+	for _, invalid := range []string{
+		`{"status_url": "http://10.0.0.1/status"}`,
+		`[]`,
+		`[{"status_module": "discover"}]`,
+		`[{"status_url": "ftp://10.0.0.1/status"}]`,
+		`[{"status_url": "http://10.0.0.1/status"}, {"status_url": "http://10.0.0.1:80/api/9"}]`,
+	} {
+		args.Instances = invalid
+		_, err := newInstances(args)
+		assert.Error(t, err, invalid)
+	}
+
+	args.Instances = `[{"status_url": "http://10.0.0.1/status"}]`
+	args.ConfigDumpFile = configDumpStdin
+	_, err = newInstances(args)
+	assert.Error(t, err, "instances can't share the standard input")
+}
+
+func TestCollectInstances(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	args := argumentList{
+		DefaultArgumentList: sdk_args.DefaultArgumentList{Metrics: true, TempDir: t.TempDir()},
+		StatusModule:        httpStubStatus,
+		Instances:           `[{"status_url": "` + failing.URL + `"}, {"status_url": "` + ts.URL + `", "labels": {"role": "edge"}}]`,
+	}
+	instances, err := newInstances(args)
+	require.NoError(t, err)
+
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	errs := collectInstances(i, instances, 1)
+	require.Len(t, errs, 2)
+	assert.Error(t, errs[0])
+	assert.NoError(t, errs[1])
+
+	require.Len(t, i.Entities, 2)
+	e, err := instances[1].entity(i)
+	require.NoError(t, err)
+	require.Len(t, e.Metrics, 1)
+	assert.Equal(t, float64(291), e.Metrics[0].Metrics["net.connectionsActive"])
+	assert.Equal(t, "edge", e.Metrics[0].Metrics["label.role"])
+	assert.Equal(t, float64(1), e.Metrics[0].Metrics["nginx.scrape.success"])
+	assert.Equal(t, float64(0), e.Metrics[0].Metrics["nginx.scrape.errors"])
+	assert.Equal(t, httpStubStatus, e.Metrics[0].Metrics["integration.statusModuleDetected"])
+	assert.Equal(t, float64(200), e.Metrics[0].Metrics["integration.status.httpStatusCode"])
+	assert.Equal(t, float64(len(testNginxStandardStatus)), e.Metrics[0].Metrics["integration.status.responseSizeBytes"])
+	assert.Contains(t, e.Metrics[0].Metrics, "integration.status.requestDurationMs")
+	assert.Contains(t, e.Metrics[0].Metrics, "integration.scrapeDurationMs")
+
+	e, err = instances[0].entity(i)
+	require.NoError(t, err)
+	require.Len(t, e.Metrics, 1)
+	assert.Equal(t, float64(0), e.Metrics[0].Metrics["nginx.scrape.success"])
+	assert.Equal(t, float64(1), e.Metrics[0].Metrics["nginx.scrape.errors"])
+	assert.Contains(t, e.Metrics[0].Metrics["nginx.scrape.error"], "metrics: failed to get stats")
+	assert.Equal(t, float64(500), e.Metrics[0].Metrics["integration.status.httpStatusCode"])
+}
+
+func TestPopulateScrapeMetricsDiscovered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		body := "{}"
+		if r.URL.Path == "/" {
+			body = `["nginx","processes","connections","slabs","http","stream","resolvers","ssl"]`
+		}
+		_, err := io.WriteString(w, body)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, StatusModule: "discover", RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+
+	require.NoError(t, inst.getMetricsData(e, ms))
+	inst.populateScrapeMetrics(ms)
+	assert.Equal(t, httpAPIStatus, ms.Metrics["integration.statusModuleDetected"])
+	assert.Equal(t, float64(200), ms.Metrics["integration.status.httpStatusCode"])
+	assert.Equal(t, float64(200), ms.Metrics["integration.http.upstreams.httpStatusCode"])
+	assert.Equal(t, float64(2), ms.Metrics["integration.http.upstreams.responseSizeBytes"])
+}
+
+func TestCollectPartialFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	configPath := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte(testNginxConf), 0600))
+
+	inst := &instance{args: argumentList{
+		DefaultArgumentList: sdk_args.DefaultArgumentList{TempDir: t.TempDir()},
+		StatusURL:           ts.URL,
+		StatusModule:        httpStubStatus,
+		ConfigPath:          configPath,
+		RemoteMonitoring:    true,
+		AccessLogMetrics:    true,
+		AccessLogPath:       filepath.Join(t.TempDir(), "missing.log"),
+	}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+
+	require.NoError(t, inst.collect(i), "the inventory was collected")
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	assert.NotEmpty(t, e.Inventory.Items())
+	require.Len(t, e.Metrics, 1)
+	assert.Equal(t, float64(0), e.Metrics[0].Metrics["nginx.scrape.success"])
+	assert.Equal(t, float64(2), e.Metrics[0].Metrics["nginx.scrape.errors"])
+	assert.Regexp(t, `^metrics: .*; accessLog: `, e.Metrics[0].Metrics["nginx.scrape.error"])
+
+	inst = &instance{args: inst.args}
+	inst.args.ConfigPath = filepath.Join(t.TempDir(), "missing.conf")
+	assert.Error(t, inst.collect(i), "nothing was collected")
+}
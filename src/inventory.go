@@ -5,118 +5,154 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
 	"github.com/pkg/errors"
 )
 
-var errMissingClosingBracket = fmt.Errorf("missing closing bracket")
+// configFiles gives access to the NGINX configuration files.
+type configFiles interface {
+	open(path string) (io.ReadCloser, error)
+	glob(pattern string) ([]string, error)
+}
+
+// diskConfigFiles are the configuration files read from disk.
+type diskConfigFiles struct{}
+
+func (diskConfigFiles) open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (diskConfigFiles) glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
 
 func populateInventory(reader *bufio.Reader, i *inventory.Inventory) error {
-	var curCmd string
-	var curValue string
+	directives, err := parseConfig(reader)
+	if err != nil {
+		return err
+	}
+	redactor, err := newConfigRedactor(nil, "", "")
+	if err != nil {
+		return err
+	}
+	return addConfigItems(i, directives, redactor)
+}
 
-	prefix := make([]string, 0, 10)
-	lineNo := 1
+// addConfigItems reports the directives as inventory items, followed by the virtual hosts and upstreams they define.
+func addConfigItems(i *inventory.Inventory, directives []*configDirective, redactor *configRedactor) error {
+	if err := addInventoryItems(i, directives, redactor); err != nil {
+		return err
+	}
+	if err := addVirtualHostItems(i, virtualHosts(directives, redactor)); err != nil {
+		return err
+	}
+	return addUpstreamItems(i, configUpstreams(directives))
+}
 
-	for {
-		r, _, err := reader.ReadRune()
-		if err != nil {
-			// If we reached the end of the file no error should be returned.
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
+// addInventoryItems reports the directives as inventory items keyed by the path of the blocks they're in, e.g.
+// "http/server/location::status/allow". Every occurrence of a repeated directive is kept: the first one at its path and
+// the following ones at the path with their index, e.g. "http/server/listen[1]". Directives read from a file are
+// annotated with it as their source, and secrets are redacted.
+func addInventoryItems(i *inventory.Inventory, directives []*configDirective, redactor *configRedactor) error {
+	occurrences := make(map[string]int)
+	return walkConfig(nil, nil, directives, redactor, func(path string, d, parent *configDirective) error {
+		name, value := redactor.redact(d, parent)
+		path = strings.TrimSuffix(path, d.name) + name
 
-			return fmt.Errorf("reading file at line %d: %w", lineNo, err)
+		key := path
+		if n := occurrences[path]; n > 0 {
+			key = fmt.Sprintf("%s[%d]", path, n)
 		}
+		occurrences[path]++
 
-		switch r {
-		case '{':
-			// parse start section
-			if curValue != "" {
-				curValue = strings.Replace(curValue, "/", ":", -1)
-				prefix = append(prefix, fmt.Sprintf("%s:%s", curCmd, strings.Trim(curValue, " \t")))
-			} else {
-				prefix = append(prefix, curCmd)
-			}
-			curCmd = ""
-			curValue = ""
-		case '}':
-			// parse end section
-			closeIdx := len(prefix) - 1
-			if closeIdx < 0 {
-				return fmt.Errorf("at line %d: %w", lineNo, errMissingClosingBracket)
-			}
-			prefix = prefix[:closeIdx]
-		case ';':
-			// parse end statement
-			prefix = append(prefix, curCmd)
-			err = i.SetItem(strings.Join(prefix, "/"), "value", curValue)
-			if err != nil {
+		if err := i.SetItem(key, "value", value); err != nil {
+			return err
+		}
+		if d.file != "" {
+			if err := i.SetItem(key, "source", d.file); err != nil {
 				return err
 			}
-			prefix = prefix[:len(prefix)-1]
-
-			curValue = ""
-			curCmd = ""
-		case '\n':
-			// parse end line and subsequent spaces
-			for err == nil && (r == '\n' || r == ' ' || r == '\t') {
-				if r == '\n' {
-					lineNo++
-				}
-				r, _, err = reader.ReadRune()
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						return nil
-					}
-					return fmt.Errorf("parsing line %d: %w", lineNo, err)
-				}
-			}
+		}
+		return nil
+	})
+}
 
-			err = reader.UnreadRune()
-			if err != nil {
-				return fmt.Errorf("parsing line %d: %w", lineNo, err)
-			}
-		case '#':
-			// ignore comments
-			for r != '\n' {
-				r, _, err = reader.ReadRune()
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						return nil
-					}
-					return fmt.Errorf("parsing line %d: %w", lineNo, err)
-				}
-			}
-		case '\t', ' ':
-			if curValue == "" {
-				continue
-			}
-			if curValue != "" && curCmd == "" {
-				curCmd = curValue
-				curValue = ""
-			} else {
-				curValue += string(r)
+// walkConfig calls fn with every simple directive, the block directive it's in, if any, and its path, made of the
+// blocks it's in and its name, e.g. "http/server/location::status/allow" for an allow directive in a location /status
+// block. The arguments of the blocks are redacted when redactor isn't nil.
+func walkConfig(prefix []string, parent *configDirective, directives []*configDirective, redactor *configRedactor, fn func(path string, d, parent *configDirective) error) error {
+	for _, d := range directives {
+		if !d.isBlock() {
+			if err := fn(strings.Join(append(prefix, d.name), "/"), d, parent); err != nil {
+				return err
 			}
-		default:
-			curValue += string(r)
+			continue
+		}
+
+		blockKey := d.name
+		if len(d.rawArgs) > 0 {
+			blockKey = fmt.Sprintf("%s:%s", d.name, strings.Replace(redactor.redactBlock(d), "/", ":", -1))
+		}
+		if err := walkConfig(append(prefix, blockKey), d, d.block, redactor, fn); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func setInventoryData(i *inventory.Inventory) error {
-	f, err := os.Open(args.ConfigPath)
+// setInventoryData reports the configuration, its virtual hosts and upstreams, and the certificates they use as
+// inventory.
+func (inst *instance) setInventoryData(i *inventory.Inventory) error {
+	directives, confPrefix, err := inst.loadConfig()
+	if err != nil {
+		return err
+	}
+	redactor, err := newConfigRedactor(inst.redactionKey, inst.args.RedactDirectives, inst.args.RedactValuePatterns)
 	if err != nil {
-		return fmt.Errorf("cannot open nginx config file '%s': %w", args.ConfigPath, err)
+		return err
+	}
+	if err := addConfigItems(i, directives, redactor); err != nil {
+		return err
+	}
+
+	return addCertificateItems(i, loadCertificates(directives, confPrefix))
+}
+
+// loadConfig loads the configuration from the inventory source: the configuration file and the files it includes, or
+// the configuration NGINX loaded as printed by nginx -T. It also returns the configuration prefix relative paths are
+// resolved from.
+func (inst *instance) loadConfig() (directives []*configDirective, confPrefix string, err error) {
+	switch inst.args.InventorySource {
+	case "", inventorySourceConfigFile:
+		directives, err = loadConfigFile(diskConfigFiles{}, inst.args.ConfigPath)
+		return directives, filepath.Dir(inst.args.ConfigPath), err
+	case inventorySourceNginxT:
+		dump, err := inst.readConfigDump()
+		if err != nil {
+			return nil, "", err
+		}
+		directives, err = loadConfigFile(dump, dump.paths[0])
+		return directives, filepath.Dir(dump.paths[0]), err
+	default:
+		return nil, "", errors.Errorf("unknown inventory source '%s'", inst.args.InventorySource)
 	}
-	defer f.Close()
+}
 
-	err = populateInventory(bufio.NewReader(f), i)
+// configDirectives parses the configuration file, and the files it includes, into the directives at each path, in the
+// order they're found, e.g. "http/log_format" -> the log_format directives of the http block.
+func configDirectives(configPath string) (map[string][]*configDirective, error) {
+	directives, err := loadConfigFile(diskConfigFiles{}, configPath)
 	if err != nil {
-		return fmt.Errorf("error parsing inventory from nginx config file '%s': %w", args.ConfigPath, err)
+		return nil, err
 	}
 
-	return nil
+	byPath := make(map[string][]*configDirective)
+	err = walkConfig(nil, nil, directives, nil, func(path string, d, _ *configDirective) error {
+		byPath[path] = append(byPath[path], d)
+		return nil
+	})
+	return byPath, err
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -103,3 +104,83 @@ func TestParseNginxConfWithClosingComment(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 }
+
+func TestPopulateInventoryFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"nginx.conf": `
+include modules/*.conf;
+events {
+  worker_connections 1024;
+}
+http {
+  include mime.types;
+  include conf.d/*.conf;
+  include sites-enabled/*;
+}
+`,
+		"mime.types":            "types {\n  text/html html;\n}\n",
+		"modules/stream.conf":   "load_module modules/ngx_stream_module.so;\n",
+		"conf.d/gzip.conf":      "gzip on;\n",
+		"sites-enabled/default": "server {\n  listen 8080;\n  include snippets/ssl.conf;\n}\n",
+		"snippets/ssl.conf":     "ssl_protocols TLSv1.3;\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	inst := &instance{args: argumentList{ConfigPath: filepath.Join(dir, "nginx.conf")}}
+
+	i := inventory.New()
+	require.NoError(t, inst.setInventoryData(i))
+	assert.Equal(t, "modules/ngx_stream_module.so", i.Items()["load_module"]["value"])
+	assert.Equal(t, "html", i.Items()["http/types/text/html"]["value"])
+	assert.Equal(t, "on", i.Items()["http/gzip"]["value"])
+	assert.Equal(t, "8080", i.Items()["http/server/listen"]["value"])
+	assert.Equal(t, "TLSv1.3", i.Items()["http/server/ssl_protocols"]["value"])
+
+	// An include without wildcards must exist.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d/missing.conf"), []byte("include missing.conf;\n"), 0600))
+	assert.Error(t, inst.setInventoryData(inventory.New()))
+
+	// Include loops are detected.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d/missing.conf"), []byte("include conf.d/*.conf;\n"), 0600))
+	err := inst.setInventoryData(inventory.New())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include loop")
+}
+
+func TestParseNginxConfQuoted(t *testing.T) {
+	i := inventory.New()
+	err := populateInventory(bufio.NewReader(strings.NewReader(`
+http {
+  server {
+    add_header X-Frame-Options "SAMEORIGIN; preload";
+    location ~ ^/(a|b){2}$ {
+      return 200 "#ok";
+    }
+    location /status {
+      stub_status on;
+    }
+  }
+}`)), i)
+	require.NoError(t, err)
+
+	assert.Equal(t, `X-Frame-Options "SAMEORIGIN; preload"`, i.Items()["http/server/add_header"]["value"])
+	assert.Equal(t, `200 "#ok"`, i.Items()["http/server/location:~ ^:(a|b){2}$/return"]["value"])
+	assert.Equal(t, "on", i.Items()["http/server/location::status/stub_status"]["value"])
+}
+
+func TestParseNginxConfRepeatedDirectives(t *testing.T) {
+	i := inventory.New()
+	require.NoError(t, populateInventory(bufio.NewReader(strings.NewReader(testNginxConf)), i))
+
+	assert.Equal(t, "80 default_server", i.Items()["http/server/listen"]["value"])
+	assert.Equal(t, "[::]:80 default_server", i.Items()["http/server/listen[1]"]["value"])
+	assert.Equal(t, "404 /404.html", i.Items()["http/server/error_page"]["value"])
+	assert.Equal(t, "500 502 503 504 /50x.html", i.Items()["http/server/error_page[1]"]["value"])
+	assert.Equal(t, "192.168.100.0/24", i.Items()["http/server/location::status/allow"]["value"])
+	assert.Equal(t, "all", i.Items()["http/server/location::status/deny"]["value"])
+	assert.NotContains(t, i.Items(), "http/server/listen[2]")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/pkg/errors"
+)
+
+// logPathArguments are the arguments overriding the path of each log directive.
+var logPathArguments = map[string]string{
+	"access_log": "ACCESS_LOG_PATH",
+	"error_log":  "ERROR_LOG_PATH",
+}
+
+// logFilePath returns the file a log directive writes to. As in NGINX, relative paths are resolved from the NGINX
+// prefix, which can't be told from the configuration, so they return an error unless nginxPrefix is set. Logs sent to
+// stderr, syslog or a memory buffer aren't files, and return an error.
+func logFilePath(directive, path, configPath, nginxPrefix string) (string, error) {
+	if path == "stderr" || strings.HasPrefix(path, "syslog:") || strings.HasPrefix(path, "memory:") {
+		return "", errors.Errorf("%s %s in nginx config file '%s' isn't a file", directive, path, configPath)
+	}
+	if !filepath.IsAbs(path) {
+		if nginxPrefix == "" {
+			return "", errors.Errorf("%s %s in nginx config file '%s' is relative to the NGINX prefix, set NGINX_PREFIX or %s",
+				directive, path, configPath, logPathArguments[directive])
+		}
+		path = filepath.Join(nginxPrefix, path)
+	}
+	return path, nil
+}
+
+// logCursor is the position in a log file, persisted between executions to only read the lines appended since then.
+type logCursor struct {
+	Inode  uint64
+	Offset int64
+}
+
+// logState is persisted between executions to only read the lines appended to a log since then.
+type logState struct {
+	logCursor
+	// Counters accumulates the values read across executions, so their rates are computed as any other PRATE metric.
+	Counters map[string]float64
+}
+
+// updateLogState loads the state of a log from the store, lets read update it and stores it again. The first
+// execution, without a stored state, starts with the counters at zero, as the base for the following rates.
+func updateLogState(store persist.Storer, key string, counters []string, read func(state *logState, firstRead bool) error) error {
+	var state logState
+	_, err := store.Get(key, &state)
+	if err != nil && !errors.Is(err, persist.ErrNotFound) {
+		return err
+	}
+	firstRead := err != nil
+	if firstRead || state.Counters == nil {
+		state.Counters = make(map[string]float64, len(counters))
+		for _, counter := range counters {
+			state.Counters[counter] = 0
+		}
+	}
+
+	if err := read(&state, firstRead); err != nil {
+		return err
+	}
+	store.Set(key, state)
+	return nil
+}
+
+// tailLog calls readLine for each complete line appended to the log since the cursor, starting over when the log has
+// been rotated or truncated, and moves the cursor past them. On the first read the cursor is only moved to the end of
+// the log, so its existing lines aren't read.
+func tailLog(path string, cursor *logCursor, firstRead bool, readLine func(line string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open log file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	inode := fileInode(info)
+	if firstRead {
+		*cursor = logCursor{Inode: inode, Offset: info.Size()}
+		return nil
+	}
+	if inode != cursor.Inode || info.Size() < cursor.Offset {
+		*cursor = logCursor{Inode: inode}
+	}
+
+	if _, err = f.Seek(cursor.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial line is read again on the next execution, once NGINX has finished writing it.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading log file '%s': %w", path, err)
+		}
+		cursor.Offset += int64(len(line))
+		readLine(line)
+	}
+}
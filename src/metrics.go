@@ -3,12 +3,16 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-
+	"net"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,6 +20,7 @@ import (
 
 	"github.com/jeremywohl/flatten"
 	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
 	"github.com/newrelic/infra-integrations-sdk/v3/log"
 	"github.com/pkg/errors"
 )
@@ -161,6 +166,8 @@ func populateMetrics(sample *metric.Set, metrics map[string]interface{}, metrics
 			rawMetric, ok = metrics[source]
 		case func(map[string]interface{}) (int, bool):
 			rawMetric, ok = source(metrics)
+		case func(map[string]interface{}) (float64, bool):
+			rawMetric, ok = source(metrics)
 		default:
 			log.Warn("Invalid raw source metric for %s", metricName)
 			continue
@@ -179,10 +186,42 @@ func populateMetrics(sample *metric.Set, metrics map[string]interface{}, metrics
 	return nil
 }
 
-func getMetricsData(sample *metric.Set) error {
-	switch args.StatusModule {
+// setRawMetrics sets the values as gauges, or attributes when they're strings. Attributes are only set when known, e.g.
+// the status module isn't detected when the status URL is down.
+func setRawMetrics(sample *metric.Set, rawMetrics map[string]interface{}) {
+	for name, value := range rawMetrics {
+		sourceType := metric.GAUGE
+		if _, ok := value.(string); ok {
+			if value == "" {
+				continue
+			}
+			sourceType = metric.ATTRIBUTE
+		}
+		if err := sample.SetMetric(name, value, sourceType); err != nil {
+			log.Warn("Error setting value: %s", err)
+		}
+	}
+}
+
+func (inst *instance) getMetricsData(e *integration.Entity, sample *metric.Set) error {
+	start := time.Now()
+	defer func() {
+		inst.scrapeDuration = time.Since(start)
+	}()
+
+	// The client and headers are built before the first request, so a wrong setting fails the stage once instead of
+	// every request.
+	if _, err := inst.httpClient(); err != nil {
+		return err
+	}
+	if _, err := inst.statusHeader(); err != nil {
+		return err
+	}
+
+	switch inst.args.StatusModule {
 	case httpStubStatus:
-		resp, err := getStatus("")
+		inst.statusModule = httpStubStatus
+		resp, err := inst.getStatus("")
 		if err != nil {
 			return err
 		}
@@ -198,7 +237,8 @@ func getMetricsData(sample *metric.Set) error {
 		rawMetrics["version"] = rawVersion
 		return populateMetrics(sample, rawMetrics, metricsDefinition)
 	case httpStatus:
-		resp, err := getStatus("")
+		inst.statusModule = httpStatus
+		resp, err := inst.getStatus("")
 		if err != nil {
 			return err
 		}
@@ -211,45 +251,76 @@ func getMetricsData(sample *metric.Set) error {
 		}
 		return populateMetrics(sample, rawMetrics, metricsDefinition)
 	case httpAPIStatus:
-		return pollHttpAPIStatusEndpoints(sample)
+		inst.statusModule = httpAPIStatus
+		return inst.pollHttpAPIStatusEndpoints(e, sample)
 	default:
-		return getDiscoveredMetricsData(sample)
+		return inst.getDiscoveredMetricsData(e, sample)
 	}
 }
 
-func pollHttpAPIStatusEndpoints(sample *metric.Set) error {
-	paths := []string{"/nginx", "/processes", "/connections", "/http/requests", "/ssl"}
-	for _, p := range paths {
-		resp, err := getStatus(p)
+// plusAPICorePaths are the NGINX Plus API endpoints available in every NGINX Plus instance. The other endpoints depend
+// on the modules configured, and aren't found when they're not.
+var plusAPICorePaths = []string{"/nginx", "/processes", "/connections", "/http/requests", "/ssl"}
+
+// pollHttpAPIStatusEndpoints reports the metrics of every NGINX Plus API endpoint. Endpoints that fail are recorded as
+// scrape errors of the instance without preventing the others from being reported; an error is only returned when none
+// of the core endpoints could be read, as the status URL isn't an NGINX Plus API then.
+func (inst *instance) pollHttpAPIStatusEndpoints(e *integration.Entity, sample *metric.Set) error {
+	var errs []error
+	read := 0
+	for _, p := range plusAPICorePaths {
+		resp, err := inst.getStatus(p)
 		if err != nil {
-			log.Warn("Request to endpoint failed: %s", err)
+			errs = append(errs, err)
 			continue
 		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				log.Warn("Unable to close response body: %s", err)
-			}
-		}()
-		getHTTPAPIMetrics(p, sample, bufio.NewReader(resp.Body))
+		err = getHTTPAPIMetrics(p, sample, bufio.NewReader(resp.Body))
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Warn("Unable to close response body: %s", closeErr)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		read++
+	}
+	if read == 0 {
+		return fmt.Errorf("no NGINX Plus API core endpoint could be read: %w", errs[0])
+	}
+
+	for _, endpoint := range plusAPIUpstreamEndpoints {
+		if err := inst.pollHTTPAPIUpstreams(e, endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, endpoint := range plusAPIZoneEndpoints {
+		if err := inst.pollHTTPAPIZones(e, endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, err := range errs {
+		inst.scrapeFailed(stageMetrics, err)
 	}
 	return nil
 }
 
-func getHTTPAPIMetrics(path string, sample *metric.Set, reader *bufio.Reader) {
+// getHTTPAPIMetrics reports the metrics of an NGINX Plus API endpoint response. It returns an error when the response
+// isn't a JSON object.
+func getHTTPAPIMetrics(path string, sample *metric.Set, reader *bufio.Reader) error {
 	jsonMetrics := make(map[string]interface{})
 	dec := json.NewDecoder(reader)
 	err := dec.Decode(&jsonMetrics)
 	if err != nil {
-		return
+		return fmt.Errorf("invalid response from NGINX Plus API endpoint %s: %w", path, err)
 	}
 	if jsonMetrics == nil || len(jsonMetrics) <= 0 {
-		return
+		return nil
 	}
 
 	flat, err := flatten.Flatten(jsonMetrics, "", flatten.DotStyle)
 	if err != nil {
-		log.Error("Error flattening json: %+v", err)
-		return
+		return fmt.Errorf("cannot flatten NGINX Plus API endpoint %s response: %w", path, err)
 	}
 
 	for k, v := range flat {
@@ -263,6 +334,7 @@ func getHTTPAPIMetrics(path string, sample *metric.Set, reader *bufio.Reader) {
 	if err := sample.SetMetric("software.edition", "plus", metric.ATTRIBUTE); err != nil {
 		log.Error("Unable to set metric: %s", err)
 	}
+	return nil
 }
 
 var notJustDots = regexp.MustCompile(`[^.]`)
@@ -296,35 +368,204 @@ func getAttributeType(key string, v interface{}) (string, metric.SourceType) {
 	}
 }
 
-func httpClient() *http.Client {
+// httpClient returns the client for the status endpoint, created on the first request so that every request of the
+// instance reuses its connections and TLS configuration.
+func (inst *instance) httpClient() (*http.Client, error) {
+	if inst.client != nil {
+		return inst.client, nil
+	}
+
 	netClient := http.Client{
-		Timeout: time.Duration(args.ConnectionTimeout) * time.Second,
+		Timeout: time.Duration(inst.args.ConnectionTimeout) * time.Second,
+	}
+	tlsConfig, err := inst.statusTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if socketPath, _, ok, err := parseUnixSocketURL(inst.args.StatusURL); ok && err == nil {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+	netClient.Transport = transport
+	inst.client = &netClient
+	return inst.client, nil
+}
+
+// statusTLSConfig builds the TLS configuration to connect to the status URL: the CA bundle replaces the system
+// certificate pool, and the client certificate is presented to servers requiring mutual TLS. The files are only read
+// the first time.
+func (inst *instance) statusTLSConfig() (*tls.Config, error) {
+	if inst.tlsConfig != nil {
+		return inst.tlsConfig, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: !inst.args.ValidateCerts,
+		ServerName:         inst.args.TLSServerName,
+	}
+
+	if inst.args.CABundleFile != "" {
+		caBundle, err := os.ReadFile(inst.args.CABundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle file '%s': %w", inst.args.CABundleFile, err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, errors.Errorf("no certificates found in CA bundle file '%s'", inst.args.CABundleFile)
+		}
+	}
+
+	if inst.args.ClientCertFile != "" || inst.args.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(inst.args.ClientCertFile, inst.args.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate '%s' and key '%s': %w", inst.args.ClientCertFile, inst.args.ClientKeyFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	inst.tlsConfig = config
+	return inst.tlsConfig, nil
+}
+
+// statusRequestURL returns the URL to request the path of the status endpoint. For Unix domain sockets, its host is
+// only used for the Host header, as the client dials the socket.
+func (inst *instance) statusRequestURL(path string) string {
+	if _, requestPath, ok, err := parseUnixSocketURL(inst.args.StatusURL); ok && err == nil {
+		return fmt.Sprintf("%s://%s%s%s", httpProtocol, unixSocketHostname, requestPath, path)
+	}
+	return inst.args.StatusURL + path
+}
+
+// newStatusRequest creates the request for the path of the status endpoint, with the configured credentials and extra
+// headers.
+func (inst *instance) newStatusRequest(path string) (*http.Request, error) {
+	header, err := inst.statusHeader()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, inst.statusRequestURL(path), nil)
+	if err != nil {
+		return nil, err
 	}
-	if !args.ValidateCerts {
-		netClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	req.Header = header.Clone()
+	return req, nil
+}
+
+// statusHeader builds the headers sent to the status endpoint: the extra headers and the credentials. The secret files
+// are only read the first time.
+func (inst *instance) statusHeader() (http.Header, error) {
+	if inst.header != nil {
+		return inst.header, nil
+	}
+
+	header := make(http.Header)
+	if inst.args.ExtraHeaders != "" {
+		headers := make(map[string]string)
+		if err := json.Unmarshal([]byte(inst.args.ExtraHeaders), &headers); err != nil {
+			return nil, fmt.Errorf("extra headers must be a JSON object of header names and values: %w", err)
 		}
+		for name, value := range headers {
+			header.Set(name, value)
+		}
+	}
+
+	password, err := readSecret(inst.args.Password, inst.args.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	bearerToken, err := readSecret(inst.args.BearerToken, inst.args.BearerTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case inst.args.Username != "" && bearerToken != "":
+		return nil, errors.New("basic authentication and bearer token can't be used together")
+	case inst.args.Username != "":
+		credentials := base64.StdEncoding.EncodeToString([]byte(inst.args.Username + ":" + password))
+		header.Set("Authorization", "Basic "+credentials)
+	case bearerToken != "":
+		header.Set("Authorization", "Bearer "+bearerToken)
 	}
-	return &netClient
+	inst.header = header
+	return inst.header, nil
 }
 
-func getStatus(path string) (resp *http.Response, err error) {
-	netClient := httpClient()
-	resp, err = netClient.Get(args.StatusURL + path)
+// readSecret returns the secret value, or the contents of the file it's stored in, without surrounding whitespace.
+func readSecret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", errors.Errorf("a secret can't be set both as a value and as the file '%s'", file)
+	}
+
+	secret, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret file '%s': %w", file, err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+func (inst *instance) getStatus(path string) (resp *http.Response, err error) {
+	resp, err = inst.requestStatus(path)
 	if err != nil {
 		return
 	}
 	if resp.StatusCode != http.StatusOK {
-		return resp, errors.Errorf("failed to get stats from %s. Server returned code %d (%s). Expecting 200", args.StatusURL+path, resp.StatusCode, resp.Status)
+		return resp, errors.Errorf("failed to get stats from %s. Server returned code %d (%s). Expecting 200", inst.args.StatusURL+path, resp.StatusCode, resp.Status)
 	}
 	return
 }
 
+// requestStatus requests the path of the status endpoint and records its duration, status code and size for the scrape
+// metrics. The response body is read before returning, so the duration covers the whole response.
+func (inst *instance) requestStatus(path string) (*http.Response, error) {
+	netClient, err := inst.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := inst.newStatusRequest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := netClient.Do(req)
+	if err != nil {
+		var verificationErr *tls.CertificateVerificationError
+		if errors.As(err, &verificationErr) {
+			inst.recordStatusTLSVerificationError(verificationErr)
+		}
+		return nil, err
+	}
+	if resp.TLS != nil {
+		inst.recordStatusTLS(resp.TLS)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		log.Warn("Unable to close response body: %s", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	inst.statusRequests = append(inst.statusRequests, statusRequest{
+		path:       path,
+		duration:   time.Since(start),
+		statusCode: resp.StatusCode,
+		size:       len(body),
+	})
+	return resp, nil
+}
+
 // For backwards compatibility, the integration tries to discover whether the metrics are standard or nginx plus based
 // on their format
-func getDiscoveredMetricsData(sample *metric.Set) error {
-	netClient := httpClient()
-	resp, err := netClient.Get(args.StatusURL)
+func (inst *instance) getDiscoveredMetricsData(e *integration.Entity, sample *metric.Set) error {
+	resp, err := inst.requestStatus("")
 	if err != nil {
 		return err
 	}
@@ -343,14 +584,17 @@ func getDiscoveredMetricsData(sample *metric.Set) error {
 			return err
 		}
 		if strings.Contains(string(bodyBytes), nginxPlusApiRootNginxEndpoint) {
-			return pollHttpAPIStatusEndpoints(sample)
+			inst.statusModule = httpAPIStatus
+			return inst.pollHttpAPIStatusEndpoints(e, sample)
 		}
+		inst.statusModule = httpStatus
 		metricsDefinition = metricsPlusDefinition
 		rawMetrics, err = getPlusMetrics(bufio.NewReader(bytes.NewBuffer(bodyBytes)))
 		if err != nil {
 			return err
 		}
 	} else {
+		inst.statusModule = httpStubStatus
 		metricsDefinition = metricsStandardDefinition
 		rawMetrics, err = getStandardMetrics(bufio.NewReader(resp.Body))
 		if err != nil {
@@ -2,14 +2,28 @@ package main
 
 import (
 	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	sdk_args "github.com/newrelic/infra-integrations-sdk/v3/args"
 	"github.com/newrelic/infra-integrations-sdk/v3/data/attribute"
 	"github.com/newrelic/infra-integrations-sdk/v3/integration"
 	"github.com/stretchr/testify/assert"
@@ -239,8 +253,8 @@ func Test_getMetricsData(t *testing.T) {
 				attribute.Attr("port", uri.Port()),
 			)
 			t.Log(ts.URL)
-			args.StatusURL = ts.URL
-			err = getMetricsData(ms)
+			inst := &instance{args: argumentList{StatusURL: ts.URL}}
+			err = inst.getMetricsData(e, ms)
 			t.Log(err)
 			if tt.expectErr != nil {
 				assert.EqualError(t, err, tt.expectErr.Error())
@@ -252,3 +266,286 @@ func Test_getMetricsData(t *testing.T) {
 		})
 	}
 }
+
+func Test_getMetricsDataUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "status.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/status", r.URL.Path)
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: "unix:" + socketPath + ":/status", StatusModule: httpStubStatus, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:"+socketPath, e.Metadata.Name)
+
+	ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+	require.NoError(t, inst.getMetricsData(e, ms))
+	assert.Equal(t, socketPath, ms.Metrics["port"])
+	assert.Equal(t, float64(291), ms.Metrics["net.connectionsActive"])
+}
+
+// writeTestCertificate writes a self-signed certificate for the common name, valid until notAfter, and its key as PEM
+// files in the directory. It returns their paths.
+func writeTestCertificate(t *testing.T, dir, commonName string, notAfter time.Time) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, commonName+".crt")
+	keyFile = filepath.Join(dir, commonName+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func Test_getStatusMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey := writeTestCertificate(t, dir, "nri-nginx", time.Now().Add(time.Hour))
+	clientCAs := x509.NewCertPool()
+	clientPEM, err := os.ReadFile(clientCert)
+	require.NoError(t, err)
+	require.True(t, clientCAs.AppendCertsFromPEM(clientPEM))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	var connections atomic.Int32
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	caBundle := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+
+	tests := []struct {
+		name      string
+		args      argumentList
+		expectErr bool
+	}{
+		{
+			name:      "Unknown CA",
+			args:      argumentList{ValidateCerts: true, ClientCertFile: clientCert, ClientKeyFile: clientKey},
+			expectErr: true,
+		},
+		{
+			name:      "No client certificate",
+			args:      argumentList{ValidateCerts: true, CABundleFile: caBundle},
+			expectErr: true,
+		},
+		{
+			name:      "Wrong server name",
+			args:      argumentList{ValidateCerts: true, CABundleFile: caBundle, ClientCertFile: clientCert, ClientKeyFile: clientKey, TLSServerName: "nginx.internal"},
+			expectErr: true,
+		},
+		{
+			name: "Mutual TLS",
+			args: argumentList{ValidateCerts: true, CABundleFile: caBundle, ClientCertFile: clientCert, ClientKeyFile: clientKey, TLSServerName: "example.com"},
+		},
+		{
+			name:      "Invalid CA bundle",
+			args:      argumentList{ValidateCerts: true, CABundleFile: clientKey},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := &instance{args: tt.args}
+			inst.args.StatusURL = ts.URL
+			inst.args.ConnectionTimeout = 5
+
+			resp, err := inst.getStatus("")
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, resp.Body.Close())
+
+			// Following requests reuse the client and its connection.
+			client, before := inst.client, connections.Load()
+			resp, err = inst.getStatus("")
+			require.NoError(t, err)
+			assert.NoError(t, resp.Body.Close())
+			assert.Same(t, client, inst.client)
+			assert.Equal(t, before, connections.Load())
+		})
+	}
+}
+
+func Test_newStatusRequest(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cr3t\n"), 0600))
+
+	tests := []struct {
+		name          string
+		args          argumentList
+		authorization string
+		headers       map[string]string
+		expectErr     bool
+	}{
+		{
+			name: "No credentials",
+			args: argumentList{},
+		},
+		{
+			name:          "Basic authentication",
+			args:          argumentList{Username: "nri", Password: "s3cr3t"},
+			authorization: "Basic bnJpOnMzY3IzdA==",
+		},
+		{
+			name:          "Basic authentication, password file",
+			args:          argumentList{Username: "nri", PasswordFile: secretFile},
+			authorization: "Basic bnJpOnMzY3IzdA==",
+		},
+		{
+			name:          "Bearer token file",
+			args:          argumentList{BearerTokenFile: secretFile},
+			authorization: "Bearer s3cr3t",
+		},
+		{
+			name:          "Extra headers",
+			args:          argumentList{BearerToken: "t0k3n", ExtraHeaders: `{"X-Api-Key": "k3y", "X-Scope": "nginx"}`},
+			authorization: "Bearer t0k3n",
+			headers:       map[string]string{"X-Api-Key": "k3y", "X-Scope": "nginx"},
+		},
+		{
+			name:      "Invalid extra headers",
+			args:      argumentList{ExtraHeaders: `X-Api-Key: k3y`},
+			expectErr: true,
+		},
+		{
+			name:      "Basic and bearer",
+			args:      argumentList{Username: "nri", BearerToken: "t0k3n"},
+			expectErr: true,
+		},
+		{
+			name:      "Secret value and file",
+			args:      argumentList{BearerToken: "t0k3n", BearerTokenFile: secretFile},
+			expectErr: true,
+		},
+		{
+			name:      "Missing secret file",
+			args:      argumentList{Username: "nri", PasswordFile: filepath.Join(dir, "missing")},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := &instance{args: tt.args}
+			inst.args.StatusURL = "http://127.0.0.1/api/9"
+
+			req, err := inst.newStatusRequest("/nginx")
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "http://127.0.0.1/api/9/nginx", req.URL.String())
+			assert.Equal(t, tt.authorization, req.Header.Get("Authorization"))
+			for name, value := range tt.headers {
+				assert.Equal(t, value, req.Header.Get(name))
+			}
+		})
+	}
+}
+
+func Test_getMetricsDataAuthenticated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "nri" || password != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true, Username: "nri", Password: "s3cr3t"}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+	require.NoError(t, inst.getMetricsData(e, ms))
+	assert.Equal(t, float64(291), ms.Metrics["net.connectionsActive"])
+
+	inst = &instance{args: inst.args}
+	inst.args.Password = "wrong"
+	assert.Error(t, inst.getMetricsData(e, ms))
+}
+
+func Test_getMetricsDataStatusHeader(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600))
+	inst := &instance{args: argumentList{StatusURL: ts.URL, StatusModule: httpStubStatus, BearerTokenFile: tokenFile}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+	require.NoError(t, inst.getMetricsData(e, ms))
+
+	require.NoError(t, os.Remove(tokenFile))
+	require.NoError(t, inst.getMetricsData(e, ms), "the token file is only read once")
+
+	// A wrong setting fails the stage before any request, instead of every NGINX Plus API endpoint.
+	requests.Store(0)
+	inst = &instance{args: argumentList{
+		DefaultArgumentList: sdk_args.DefaultArgumentList{Metrics: true},
+		StatusURL:           ts.URL,
+		StatusModule:        httpAPIStatus,
+		RemoteMonitoring:    true,
+		ExtraHeaders:        `X-Api-Key: k3y`,
+	}}
+	assert.Error(t, inst.collect(i))
+	require.Len(t, inst.scrapeErrors, 1)
+	assert.Contains(t, inst.scrapeErrors[0].err.Error(), "extra headers")
+	assert.Zero(t, requests.Load())
+}
@@ -5,24 +5,48 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
 
 	sdk_args "github.com/newrelic/infra-integrations-sdk/v3/args"
 	"github.com/newrelic/infra-integrations-sdk/v3/data/attribute"
 	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
 	"github.com/newrelic/infra-integrations-sdk/v3/integration"
 	"github.com/newrelic/infra-integrations-sdk/v3/log"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
 	"github.com/pkg/errors"
 )
 
 type argumentList struct {
 	sdk_args.DefaultArgumentList
-	StatusURL         string `default:"http://127.0.0.1/status" help:"NGINX status URL. If you are using ngx_http_api_module be sure to include the full path ending with the API version number"`
-	ConfigPath        string `default:"/etc/nginx/nginx.conf" help:"NGINX configuration file."`
-	RemoteMonitoring  bool   `default:"false" help:"Identifies the monitored entity as 'remote'. In doubt: set to true."`
-	ConnectionTimeout int    `default:"5" help:"Connection timeout to the Nginx instance in seconds"`
-	StatusModule      string `default:"discover" help:"Name of Nginx status module. discover | ngx_http_stub_status_module | ngx_http_status_module | ngx_http_api_module"`
-	ValidateCerts     bool   `default:"true" help:"If the status URL is HTTPS with a self-signed certificate, set this to false if you want to avoid certificate validation"`
-	ShowVersion       bool   `default:"false" help:"Print build information and exit"`
+	StatusURL              string `default:"http://127.0.0.1/status" help:"NGINX status URL. If you are using ngx_http_api_module be sure to include the full path ending with the API version number. Unix domain sockets are set as unix:/path/to/socket:/status"`
+	ConfigPath             string `default:"/etc/nginx/nginx.conf" help:"NGINX configuration file."`
+	InventorySource        string `default:"config_file" help:"Source of the configuration inventory. config_file | nginx_t. config_file parses the configuration file and its includes, nginx_t parses the output of nginx -T, the configuration NGINX loaded"`
+	NginxBinary            string `default:"nginx" help:"NGINX binary run with -T -c CONFIG_PATH when the inventory source is nginx_t"`
+	ConfigDumpFile         string `default:"" help:"File with the output of nginx -T, or - to read it from the standard input without INSTANCES, used instead of running the NGINX binary"`
+	RedactDirectives       string `default:"" help:"Comma-separated directives whose values are redacted from the configuration inventory, in addition to the built-in sensitive ones"`
+	RedactValuePatterns    string `default:"" help:"JSON list of regular expressions whose matches are redacted from the configuration inventory values, e.g. [\"sk_live_[0-9a-zA-Z]+\"]"`
+	RemoteMonitoring       bool   `default:"false" help:"Identifies the monitored entity as 'remote'. In doubt: set to true."`
+	ConnectionTimeout      int    `default:"5" help:"Connection timeout to the Nginx instance in seconds"`
+	StatusModule           string `default:"discover" help:"Name of Nginx status module. discover | ngx_http_stub_status_module | ngx_http_status_module | ngx_http_api_module"`
+	ValidateCerts          bool   `default:"true" help:"If the status URL is HTTPS with a self-signed certificate, set this to false if you want to avoid certificate validation"`
+	CABundleFile           string `default:"" help:"PEM file with the CA certificates to validate the status URL certificate, instead of the system ones"`
+	ClientCertFile         string `default:"" help:"PEM client certificate presented to status URLs requiring mutual TLS"`
+	ClientKeyFile          string `default:"" help:"PEM private key of the client certificate"`
+	TLSServerName          string `default:"" help:"Server name used to validate the status URL certificate, when it differs from the status URL host"`
+	Username               string `default:"" help:"Username for basic authentication to the status URL"`
+	Password               string `default:"" help:"Password for basic authentication to the status URL"`
+	PasswordFile           string `default:"" help:"File containing the password for basic authentication to the status URL"`
+	BearerToken            string `default:"" help:"Bearer token sent in the Authorization header to the status URL"`
+	BearerTokenFile        string `default:"" help:"File containing the bearer token sent in the Authorization header to the status URL"`
+	ExtraHeaders           string `default:"" help:"JSON object of additional headers sent to the status URL, e.g. {\"X-Api-Key\": \"secret\"}"`
+	ShowVersion            bool   `default:"false" help:"Print build information and exit"`
+	AccessLogMetrics       bool   `default:"false" help:"Report request metrics derived from the lines appended to the NGINX access log since the previous execution"`
+	AccessLogPath          string `default:"" help:"NGINX access log file. Defaults to the http access_log found in the configuration file"`
+	ErrorLogMetrics        bool   `default:"false" help:"Report the rate of error log lines per level, and events for the most severe ones, appended since the previous execution"`
+	ErrorLogPath           string `default:"" help:"NGINX error log file. Defaults to the error_log found in the configuration file"`
+	NginxPrefix            string `default:"" help:"NGINX prefix, as printed by nginx -V, relative access_log and error_log paths are resolved from, e.g. /usr/local/nginx. Also passed as -p to NGINX_BINARY"`
+	Instances              string `default:"" help:"JSON list of NGINX instances monitored by the same execution, e.g. [{\"status_url\": \"http://10.0.0.1/status\", \"labels\": {\"role\": \"edge\"}}]. Instances can set status_url, status_module, config_path and labels, share the rest of the arguments and are always remote entities"`
+	MaxConcurrentInstances int    `default:"4" help:"Maximum number of instances collected at the same time"`
 }
 
 const (
@@ -35,6 +59,10 @@ const (
 	httpDefaultPort  = `80`
 	httpsDefaultPort = `443`
 
+	unixProtocol       = `unix`
+	httpUnixProtocol   = `http+unix`
+	unixSocketHostname = `localhost`
+
 	httpStubStatus = "ngx_http_stub_status_module"
 	httpStatus     = "ngx_http_status_module"
 	httpAPIStatus  = "ngx_http_api_module"
@@ -64,25 +92,65 @@ func main() {
 		os.Exit(0)
 	}
 
-	e, err := entity(i)
+	instances, err := newInstances(args)
 	fatalIfErr(err)
 
+	var redactionKeyStore persist.Storer
 	if args.HasInventory() {
-		fatalIfErr(setInventoryData(e.Inventory))
+		key, store, err := loadRedactionKey(i, args.TempDir)
+		if err != nil {
+			log.Warn("Unable to load the redaction key, redacted inventory values will change on every execution: %s", err)
+		}
+		redactionKeyStore = store
+		for _, inst := range instances {
+			inst.redactionKey = key
+		}
 	}
 
-	if args.HasMetrics() {
-		ms := metricSet(e, "NginxSample", args.RemoteMonitoring)
-		err = getMetricsData(ms)
-		fatalIfErr(err)
+	failed := 0
+	for n, err := range collectInstances(i, instances, args.MaxConcurrentInstances) {
+		if err != nil {
+			log.Error("Unable to collect data from %s: %s", instances[n].args.StatusURL, err)
+			failed++
+		}
 	}
 
+	// What was collected is published even when some stages failed, as their failures are reported in the samples.
 	fatalIfErr(i.Publish())
+
+	for _, inst := range instances {
+		if inst.store != nil {
+			if err := inst.store.Save(); err != nil {
+				log.Warn("Unable to save state store: %s", err)
+			}
+		}
+	}
+	if redactionKeyStore != nil {
+		if err := redactionKeyStore.Save(); err != nil {
+			log.Warn("Unable to save the redaction key: %s", err)
+		}
+	}
+
+	if failed == len(instances) {
+		log.Fatal(errors.New("no data could be collected from any NGINX instance"))
+	}
 }
 
-func entity(i *integration.Integration) (*integration.Entity, error) {
-	if args.RemoteMonitoring {
-		hostname, port, err := parseStatusURL(args.StatusURL)
+// newStateStore creates a store, unique for the instance arguments, to keep state between executions. It's kept apart
+// from the SDK store used for rates and deltas, which isn't reachable from the integration.
+func (inst *instance) newStateStore(i *integration.Integration) (persist.Storer, error) {
+	storePath, err := persist.NewStorePath(integrationName+"-state", inst.uniqueID(), inst.args.TempDir, i.Logger(), inst.args.CacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	storePath.CleanOldFiles()
+
+	return persist.NewFileStore(storePath.GetFilePath(), i.Logger(), inst.args.CacheTTL)
+}
+
+func (inst *instance) entity(i *integration.Integration) (*integration.Entity, error) {
+	if inst.args.RemoteMonitoring {
+		hostname, port, err := parseStatusURL(inst.args.StatusURL)
 		if err != nil {
 			return nil, err
 		}
@@ -93,25 +161,36 @@ func entity(i *integration.Integration) (*integration.Entity, error) {
 	return i.LocalEntity(), nil
 }
 
-func metricSet(e *integration.Entity, eventType string, remote bool) *metric.Set {
-	hostname, port, err := parseStatusURL(args.StatusURL)
+// metricSet creates a metric set for the NGINX instance. Additional attributes identify the object the sample
+// belongs to (e.g. an upstream peer) when more than one sample of the same event type is reported.
+func (inst *instance) metricSet(e *integration.Entity, eventType string, remote bool, attrs ...attribute.Attribute) *metric.Set {
+	hostname, port, err := parseStatusURL(inst.args.StatusURL)
 	fatalIfErr(err)
 	if remote {
 		return e.NewMetricSet(
 			eventType,
-			attribute.Attr("hostname", hostname),
-			attribute.Attr("port", port),
+			append([]attribute.Attribute{
+				attribute.Attr("hostname", hostname),
+				attribute.Attr("port", port),
+			}, attrs...)...,
 		)
 	}
 
 	return e.NewMetricSet(
 		eventType,
-		attribute.Attr("port", port),
+		append([]attribute.Attribute{
+			attribute.Attr("port", port),
+		}, attrs...)...,
 	)
 }
 
-// parseStatusURL will extract the hostname and the port from the nginx status URL.
+// parseStatusURL will extract the hostname and the port from the nginx status URL. For Unix domain sockets, the
+// hostname is always localhost and the socket path takes the place of the port.
 func parseStatusURL(statusURL string) (hostname, port string, err error) {
+	if socketPath, _, ok, err := parseUnixSocketURL(statusURL); ok {
+		return unixSocketHostname, socketPath, err
+	}
+
 	u, err := url.Parse(statusURL)
 	if err != nil {
 		return
@@ -138,6 +217,39 @@ func parseStatusURL(statusURL string) (hostname, port string, err error) {
 	return
 }
 
+// parseUnixSocketURL extracts the socket path and the HTTP request path from a status URL pointing to a Unix domain
+// socket. It accepts the NGINX syntax, unix:/run/nginx/status.sock:/status, also with the http+unix scheme, and the
+// percent-encoded socket path, http+unix://%2Frun%2Fnginx%2Fstatus.sock/status. ok is false when the URL doesn't
+// point to a Unix domain socket.
+func parseUnixSocketURL(statusURL string) (socketPath, requestPath string, ok bool, err error) {
+	var rest string
+	switch {
+	case strings.HasPrefix(statusURL, httpUnixProtocol+"://"):
+		rest = strings.TrimPrefix(statusURL, httpUnixProtocol+"://")
+		if !strings.HasPrefix(rest, "/") {
+			host, path := rest, "/"
+			if i := strings.Index(rest, "/"); i >= 0 {
+				host, path = rest[:i], rest[i:]
+			}
+			socketPath, err = url.PathUnescape(host)
+			return socketPath, path, true, err
+		}
+	case strings.HasPrefix(statusURL, unixProtocol+":"):
+		rest = strings.TrimPrefix(strings.TrimPrefix(statusURL, unixProtocol+":"), "//")
+	default:
+		return "", "", false, nil
+	}
+
+	socketPath, requestPath = rest, "/"
+	if i := strings.Index(rest, ":"); i >= 0 {
+		socketPath, requestPath = rest[:i], rest[i+1:]
+	}
+	if socketPath == "" {
+		err = errors.New("unix: no socket path in status URL")
+	}
+	return socketPath, requestPath, true, err
+}
+
 // isHTTP is checking if the URL is http/s protocol.
 func isHTTP(u *url.URL) bool {
 	return u.Scheme == httpProtocol || u.Scheme == httpsProtocol
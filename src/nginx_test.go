@@ -9,13 +9,13 @@ import (
 )
 
 func TestEntityLocal(t *testing.T) {
-	args = argumentList{
+	inst := &instance{args: argumentList{
 		RemoteMonitoring: false,
-	}
+	}}
 	i, err := integration.New("test", integrationVersion)
 	assert.NoError(t, err)
 
-	e, err := entity(i)
+	e, err := inst.entity(i)
 	assert.NoError(t, err)
 	assert.Nil(t, e.Metadata)
 }
@@ -45,15 +45,53 @@ func TestParseURL(t *testing.T) {
 	assert.True(t, strings.Contains(err5.Error(), "unsupported protocol scheme"))
 }
 
+func TestParseUnixSocketURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusURL   string
+		socketPath  string
+		requestPath string
+		ok          bool
+		expectErr   bool
+	}{
+		{"NGINX syntax", "unix:/run/nginx/status.sock:/status", "/run/nginx/status.sock", "/status", true, false},
+		{"NGINX syntax, slashes", "unix:///run/nginx/status.sock:/api/9", "/run/nginx/status.sock", "/api/9", true, false},
+		{"No request path", "unix:/run/nginx/status.sock", "/run/nginx/status.sock", "/", true, false},
+		{"http+unix", "http+unix:///run/nginx/status.sock:/status", "/run/nginx/status.sock", "/status", true, false},
+		{"http+unix, encoded", "http+unix://%2Frun%2Fnginx%2Fstatus.sock/status", "/run/nginx/status.sock", "/status", true, false},
+		{"Bad escape", "http+unix://%zz/status", "", "/status", true, true},
+		{"No socket", "unix::/status", "", "/status", true, true},
+		{"HTTP", "http://localhost/status", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socketPath, requestPath, ok, err := parseUnixSocketURL(tt.statusURL)
+			assert.Equal(t, tt.ok, ok)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.socketPath, socketPath)
+			assert.Equal(t, tt.requestPath, requestPath)
+		})
+	}
+
+	hostname, port, err := parseStatusURL("unix:/run/nginx/status.sock:/status")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", hostname)
+	assert.Equal(t, "/run/nginx/status.sock", port)
+}
+
 func TestEntityRemote(t *testing.T) {
-	args = argumentList{
+	inst := &instance{args: argumentList{
 		StatusURL:        "http://test:1234/status",
 		RemoteMonitoring: true,
-	}
+	}}
 	i, err := integration.New("test", integrationVersion)
 	assert.NoError(t, err)
 
-	e, err := entity(i)
+	e, err := inst.entity(i)
 	assert.NoError(t, err)
 	assert.Equal(t, "test:1234", e.Metadata.Name)
 	assert.Equal(t, entityRemoteType, e.Metadata.Namespace)
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jeremywohl/flatten"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/event"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/log"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/pkg/errors"
+)
+
+const (
+	upstreamEventType     = "NginxUpstreamSample"
+	upstreamPeerEventType = "NginxUpstreamPeerSample"
+	serverZoneEventType   = "NginxServerZoneSample"
+	locationZoneEventType = "NginxLocationZoneSample"
+	cacheEventType        = "NginxCacheSample"
+	limitReqEventType     = "NginxLimitReqSample"
+	limitConnEventType    = "NginxLimitConnSample"
+	slabEventType         = "NginxSlabSample"
+
+	streamServerZoneEventType   = "NginxStreamServerZoneSample"
+	streamUpstreamEventType     = "NginxStreamUpstreamSample"
+	streamUpstreamPeerEventType = "NginxStreamUpstreamPeerSample"
+
+	responseCodesSource = "responses.codes."
+	slabSlotsSource     = "slots."
+
+	peerStateUp = "up"
+
+	peerStateChangeCategory = "NginxUpstreamPeerStateChange"
+)
+
+var upstreamDefinition = map[string][]interface{}{
+	"upstream.zone":                    {"zone", metric.ATTRIBUTE},
+	"upstream.keepaliveConnections":    {"keepalive", metric.GAUGE},
+	"upstream.zombies":                 {"zombies", metric.GAUGE},
+	"upstream.peers":                   {"peers", metric.GAUGE},
+	"upstream.peersUp":                 {"peers.up", metric.GAUGE},
+	"upstream.queueSize":               {"queue.size", metric.GAUGE},
+	"upstream.queueMaxSize":            {"queue.max_size", metric.GAUGE},
+	"upstream.queueOverflowsPerSecond": {"queue.overflows", metric.PRATE},
+}
+
+var upstreamPeerDefinition = map[string][]interface{}{
+	"peer.state":                  {"state", metric.ATTRIBUTE},
+	"peer.weight":                 {"weight", metric.GAUGE},
+	"peer.connectionsActive":      {"active", metric.GAUGE},
+	"peer.requestsPerSecond":      {"requests", metric.PRATE},
+	"peer.responses1xxPerSecond":  {"responses.1xx", metric.PRATE},
+	"peer.responses2xxPerSecond":  {"responses.2xx", metric.PRATE},
+	"peer.responses3xxPerSecond":  {"responses.3xx", metric.PRATE},
+	"peer.responses4xxPerSecond":  {"responses.4xx", metric.PRATE},
+	"peer.responses5xxPerSecond":  {"responses.5xx", metric.PRATE},
+	"peer.bytesSentPerSecond":     {"sent", metric.PRATE},
+	"peer.bytesReceivedPerSecond": {"received", metric.PRATE},
+	"peer.fails":                  {"fails", metric.PDELTA},
+	"peer.unavail":                {"unavail", metric.PDELTA},
+	"peer.healthChecks":           {"health_checks.checks", metric.PDELTA},
+	"peer.healthChecksFailed":     {"health_checks.fails", metric.PDELTA},
+	"peer.healthChecksUnhealthy":  {"health_checks.unhealthy", metric.PDELTA},
+	"peer.downtimeMs":             {"downtime", metric.GAUGE},
+	"peer.responseTimeMs":         {"response_time", metric.GAUGE},
+	"peer.headerTimeMs":           {"header_time", metric.GAUGE},
+}
+
+var serverZoneDefinition = map[string][]interface{}{
+	"serverZone.processing":             {"processing", metric.GAUGE},
+	"serverZone.requestsPerSecond":      {"requests", metric.PRATE},
+	"serverZone.responsesPerSecond":     {"responses.total", metric.PRATE},
+	"serverZone.responses1xxPerSecond":  {"responses.1xx", metric.PRATE},
+	"serverZone.responses2xxPerSecond":  {"responses.2xx", metric.PRATE},
+	"serverZone.responses3xxPerSecond":  {"responses.3xx", metric.PRATE},
+	"serverZone.responses4xxPerSecond":  {"responses.4xx", metric.PRATE},
+	"serverZone.responses5xxPerSecond":  {"responses.5xx", metric.PRATE},
+	"serverZone.discardedPerSecond":     {"discarded", metric.PRATE},
+	"serverZone.bytesReceivedPerSecond": {"received", metric.PRATE},
+	"serverZone.bytesSentPerSecond":     {"sent", metric.PRATE},
+}
+
+var locationZoneDefinition = map[string][]interface{}{
+	"locationZone.requestsPerSecond":      {"requests", metric.PRATE},
+	"locationZone.responsesPerSecond":     {"responses.total", metric.PRATE},
+	"locationZone.responses1xxPerSecond":  {"responses.1xx", metric.PRATE},
+	"locationZone.responses2xxPerSecond":  {"responses.2xx", metric.PRATE},
+	"locationZone.responses3xxPerSecond":  {"responses.3xx", metric.PRATE},
+	"locationZone.responses4xxPerSecond":  {"responses.4xx", metric.PRATE},
+	"locationZone.responses5xxPerSecond":  {"responses.5xx", metric.PRATE},
+	"locationZone.discardedPerSecond":     {"discarded", metric.PRATE},
+	"locationZone.bytesReceivedPerSecond": {"received", metric.PRATE},
+	"locationZone.bytesSentPerSecond":     {"sent", metric.PRATE},
+}
+
+var cacheDefinition = map[string][]interface{}{
+	"cache.sizeBytes":                     {"size", metric.GAUGE},
+	"cache.maxSizeBytes":                  {"max_size", metric.GAUGE},
+	"cache.cold":                          {cacheCold, metric.GAUGE},
+	"cache.hitPercent":                    {cacheHitPercent, metric.GAUGE},
+	"cache.hitResponsesPerSecond":         {"hit.responses", metric.PRATE},
+	"cache.hitBytesPerSecond":             {"hit.bytes", metric.PRATE},
+	"cache.staleResponsesPerSecond":       {"stale.responses", metric.PRATE},
+	"cache.staleBytesPerSecond":           {"stale.bytes", metric.PRATE},
+	"cache.updatingResponsesPerSecond":    {"updating.responses", metric.PRATE},
+	"cache.updatingBytesPerSecond":        {"updating.bytes", metric.PRATE},
+	"cache.revalidatedResponsesPerSecond": {"revalidated.responses", metric.PRATE},
+	"cache.revalidatedBytesPerSecond":     {"revalidated.bytes", metric.PRATE},
+	"cache.missResponsesPerSecond":        {"miss.responses", metric.PRATE},
+	"cache.missBytesPerSecond":            {"miss.bytes", metric.PRATE},
+	"cache.expiredResponsesPerSecond":     {"expired.responses", metric.PRATE},
+	"cache.expiredBytesPerSecond":         {"expired.bytes", metric.PRATE},
+	"cache.bypassResponsesPerSecond":      {"bypass.responses", metric.PRATE},
+	"cache.bypassBytesPerSecond":          {"bypass.bytes", metric.PRATE},
+}
+
+var limitReqDefinition = map[string][]interface{}{
+	"limitReq.passedPerSecond":         {"passed", metric.PRATE},
+	"limitReq.delayedPerSecond":        {"delayed", metric.PRATE},
+	"limitReq.rejectedPerSecond":       {"rejected", metric.PRATE},
+	"limitReq.delayedDryRunPerSecond":  {"delayed_dry_run", metric.PRATE},
+	"limitReq.rejectedDryRunPerSecond": {"rejected_dry_run", metric.PRATE},
+}
+
+var limitConnDefinition = map[string][]interface{}{
+	"limitConn.passedPerSecond":         {"passed", metric.PRATE},
+	"limitConn.rejectedPerSecond":       {"rejected", metric.PRATE},
+	"limitConn.rejectedDryRunPerSecond": {"rejected_dry_run", metric.PRATE},
+}
+
+var slabDefinition = map[string][]interface{}{
+	"slab.pagesUsed":        {"pages.used", metric.GAUGE},
+	"slab.pagesFree":        {"pages.free", metric.GAUGE},
+	"slab.pagesUsedPercent": {slabPagesUsedPercent, metric.GAUGE},
+	"slab.reqsPerSecond":    {slabSlotsReqs, metric.PRATE},
+	"slab.fails":            {slabSlotsFails, metric.PDELTA},
+}
+
+var streamServerZoneDefinition = map[string][]interface{}{
+	"streamServerZone.processing":             {"processing", metric.GAUGE},
+	"streamServerZone.connectionsPerSecond":   {"connections", metric.PRATE},
+	"streamServerZone.sessionsPerSecond":      {"sessions.total", metric.PRATE},
+	"streamServerZone.sessions2xxPerSecond":   {"sessions.2xx", metric.PRATE},
+	"streamServerZone.sessions4xxPerSecond":   {"sessions.4xx", metric.PRATE},
+	"streamServerZone.sessions5xxPerSecond":   {"sessions.5xx", metric.PRATE},
+	"streamServerZone.discardedPerSecond":     {"discarded", metric.PRATE},
+	"streamServerZone.bytesReceivedPerSecond": {"received", metric.PRATE},
+	"streamServerZone.bytesSentPerSecond":     {"sent", metric.PRATE},
+}
+
+var streamUpstreamDefinition = map[string][]interface{}{
+	"streamUpstream.zone":    {"zone", metric.ATTRIBUTE},
+	"streamUpstream.zombies": {"zombies", metric.GAUGE},
+	"streamUpstream.peers":   {"peers", metric.GAUGE},
+	"streamUpstream.peersUp": {"peers.up", metric.GAUGE},
+}
+
+// streamUpstreamPeerDefinition has its own prefix, as the rates and deltas of a sample are kept by its attributes and
+// metric names, so an http and a stream upstream with the same name and servers would share them.
+var streamUpstreamPeerDefinition = map[string][]interface{}{
+	"streamPeer.state":                  {"state", metric.ATTRIBUTE},
+	"streamPeer.weight":                 {"weight", metric.GAUGE},
+	"streamPeer.connectionsActive":      {"active", metric.GAUGE},
+	"streamPeer.connectionsPerSecond":   {"connections", metric.PRATE},
+	"streamPeer.bytesSentPerSecond":     {"sent", metric.PRATE},
+	"streamPeer.bytesReceivedPerSecond": {"received", metric.PRATE},
+	"streamPeer.fails":                  {"fails", metric.PDELTA},
+	"streamPeer.unavail":                {"unavail", metric.PDELTA},
+	"streamPeer.healthChecks":           {"health_checks.checks", metric.PDELTA},
+	"streamPeer.healthChecksFailed":     {"health_checks.fails", metric.PDELTA},
+	"streamPeer.healthChecksUnhealthy":  {"health_checks.unhealthy", metric.PDELTA},
+	"streamPeer.downtimeMs":             {"downtime", metric.GAUGE},
+	"streamPeer.connectTimeMs":          {"connect_time", metric.GAUGE},
+	"streamPeer.firstByteTimeMs":        {"first_byte_time", metric.GAUGE},
+	"streamPeer.responseTimeMs":         {"response_time", metric.GAUGE},
+}
+
+// cacheServedResponses are the cache responses served from the cache, while cacheOtherResponses had to be fetched
+// from the upstream.
+var (
+	cacheServedResponses = []string{"hit.responses", "stale.responses", "updating.responses", "revalidated.responses"}
+	cacheOtherResponses  = []string{"miss.responses", "expired.responses", "bypass.responses"}
+)
+
+func cacheCold(metrics map[string]interface{}) (int, bool) {
+	cold, ok := metrics["cold"].(bool)
+	if !ok {
+		return 0, false
+	}
+	if cold {
+		return 1, true
+	}
+	return 0, true
+}
+
+// cacheHitPercent computes the percentage of the responses served from the cache since NGINX started, as shown by
+// the NGINX Plus dashboard.
+func cacheHitPercent(metrics map[string]interface{}) (float64, bool) {
+	var served, total float64
+	for _, key := range cacheServedResponses {
+		responses, _ := metrics[key].(float64)
+		served += responses
+	}
+	total = served
+	for _, key := range cacheOtherResponses {
+		responses, _ := metrics[key].(float64)
+		total += responses
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+	return served * 100 / total, true
+}
+
+// slabPagesUsedPercent computes the utilisation of the shared memory zone. Allocations fail once all its pages are
+// used.
+func slabPagesUsedPercent(metrics map[string]interface{}) (float64, bool) {
+	used, ok1 := metrics["pages.used"].(float64)
+	free, ok2 := metrics["pages.free"].(float64)
+	if !ok1 || !ok2 || used+free == 0 {
+		return 0, false
+	}
+	return used * 100 / (used + free), true
+}
+
+func slabSlotsReqs(metrics map[string]interface{}) (float64, bool) {
+	return sumSlabSlots(metrics, ".reqs")
+}
+
+func slabSlotsFails(metrics map[string]interface{}) (float64, bool) {
+	return sumSlabSlots(metrics, ".fails")
+}
+
+// sumSlabSlots adds up the given counter across all the slot sizes of a slab.
+func sumSlabSlots(metrics map[string]interface{}, suffix string) (float64, bool) {
+	var sum float64
+	found := false
+	for key, value := range metrics {
+		if !strings.HasPrefix(key, slabSlotsSource) || !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		if v, ok := value.(float64); ok {
+			sum += v
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// plusAPIZoneEndpoint describes an NGINX Plus API endpoint reporting an object per zone. A sample of eventType,
+// identified by the zone name, is reported for each of them. populateDynamic, when set, reports the metrics whose
+// names depend on the zone contents, like the response status codes it returned.
+type plusAPIZoneEndpoint struct {
+	path            string
+	eventType       string
+	definition      map[string][]interface{}
+	populateDynamic func(sample *metric.Set, rawMetrics map[string]interface{})
+}
+
+var plusAPIZoneEndpoints = []plusAPIZoneEndpoint{
+	{
+		path:            "/http/server_zones",
+		eventType:       serverZoneEventType,
+		definition:      serverZoneDefinition,
+		populateDynamic: responseCodesPopulator("serverZone.responses"),
+	},
+	{
+		path:            "/http/location_zones",
+		eventType:       locationZoneEventType,
+		definition:      locationZoneDefinition,
+		populateDynamic: responseCodesPopulator("locationZone.responses"),
+	},
+	{
+		path:       "/http/caches",
+		eventType:  cacheEventType,
+		definition: cacheDefinition,
+	},
+	{
+		path:       "/http/limit_reqs",
+		eventType:  limitReqEventType,
+		definition: limitReqDefinition,
+	},
+	{
+		path:       "/http/limit_conns",
+		eventType:  limitConnEventType,
+		definition: limitConnDefinition,
+	},
+	{
+		path:            "/slabs",
+		eventType:       slabEventType,
+		definition:      slabDefinition,
+		populateDynamic: populateSlabSlots,
+	},
+	{
+		path:       "/stream/server_zones",
+		eventType:  streamServerZoneEventType,
+		definition: streamServerZoneDefinition,
+	},
+}
+
+// plusAPIUpstreamEndpoint describes an NGINX Plus API endpoint reporting upstream groups. A sample of eventType is
+// reported per upstream, and one of peerEventType per peer in it, whose metrics start with peerPrefix.
+type plusAPIUpstreamEndpoint struct {
+	path           string
+	eventType      string
+	definition     map[string][]interface{}
+	peerEventType  string
+	peerPrefix     string
+	peerDefinition map[string][]interface{}
+}
+
+var plusAPIUpstreamEndpoints = []plusAPIUpstreamEndpoint{
+	{
+		path:           "/http/upstreams",
+		eventType:      upstreamEventType,
+		definition:     upstreamDefinition,
+		peerEventType:  upstreamPeerEventType,
+		peerPrefix:     "peer.",
+		peerDefinition: upstreamPeerDefinition,
+	},
+	{
+		path:           "/stream/upstreams",
+		eventType:      streamUpstreamEventType,
+		definition:     streamUpstreamDefinition,
+		peerEventType:  streamUpstreamPeerEventType,
+		peerPrefix:     "streamPeer.",
+		peerDefinition: streamUpstreamPeerDefinition,
+	},
+}
+
+// getHTTPAPIObjects requests an NGINX Plus API endpoint whose response is a JSON object keyed by the name of the
+// upstream or zone each entry describes.
+func (inst *instance) getHTTPAPIObjects(path string) (map[string]map[string]interface{}, error) {
+	resp, err := inst.getStatus(path)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// The endpoint isn't available when its module isn't configured, e.g. without a stream block.
+		log.Debug("Skipping endpoint not found: %s", path)
+		return nil, resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Warn("Unable to close response body: %s", err)
+		}
+	}()
+
+	objects := make(map[string]map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&objects); err != nil {
+		return nil, errors.Wrapf(err, "decoding response from %s", path)
+	}
+	return objects, nil
+}
+
+// presentDefinitions filters out the definitions whose raw metric is missing. NGINX Plus omits some optional fields
+// (e.g. response times until the first response is received), which shouldn't be logged as missing metrics.
+func presentDefinitions(metrics map[string]interface{}, metricsDefinition map[string][]interface{}) map[string][]interface{} {
+	present := make(map[string][]interface{}, len(metricsDefinition))
+	for metricName, metricInfo := range metricsDefinition {
+		if source, ok := metricInfo[0].(string); ok {
+			if _, ok := metrics[source]; !ok {
+				continue
+			}
+		}
+		present[metricName] = metricInfo
+	}
+	return present
+}
+
+// pollHTTPAPIUpstreams reports a sample per upstream group returned by the endpoint and a peer sample per server in it.
+func (inst *instance) pollHTTPAPIUpstreams(e *integration.Entity, endpoint plusAPIUpstreamEndpoint) error {
+	upstreams, err := inst.getHTTPAPIObjects(endpoint.path)
+	if err != nil {
+		return err
+	}
+
+	for name, upstream := range upstreams {
+		peers, _ := upstream["peers"].([]interface{})
+		delete(upstream, "peers")
+
+		peersUp := 0
+		for _, p := range peers {
+			peer, ok := p.(map[string]interface{})
+			if !ok {
+				log.Warn("Can't assert type for peer of upstream %s", name)
+				continue
+			}
+			if peer["state"] == peerStateUp {
+				peersUp++
+			}
+			if err := inst.populateUpstreamPeerMetrics(e, endpoint, name, peer); err != nil {
+				log.Warn("Unable to report peer of upstream %s: %s", name, err)
+			}
+		}
+
+		rawMetrics, err := flatten.Flatten(upstream, "", flatten.DotStyle)
+		if err != nil {
+			log.Error("Error flattening json: %+v", err)
+			continue
+		}
+		rawMetrics["peers"] = len(peers)
+		rawMetrics["peers.up"] = peersUp
+
+		sample := inst.metricSet(e, endpoint.eventType, inst.args.RemoteMonitoring, attribute.Attr("upstream", name))
+		if err := populateMetrics(sample, rawMetrics, presentDefinitions(rawMetrics, endpoint.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollHTTPAPIZones reports a sample per zone returned by the endpoint.
+func (inst *instance) pollHTTPAPIZones(e *integration.Entity, endpoint plusAPIZoneEndpoint) error {
+	zones, err := inst.getHTTPAPIObjects(endpoint.path)
+	if err != nil {
+		return err
+	}
+
+	for name, zone := range zones {
+		rawMetrics, err := flatten.Flatten(zone, "", flatten.DotStyle)
+		if err != nil {
+			log.Error("Error flattening json: %+v", err)
+			continue
+		}
+
+		sample := inst.metricSet(e, endpoint.eventType, inst.args.RemoteMonitoring, attribute.Attr("zone", name))
+		if err := populateMetrics(sample, rawMetrics, presentDefinitions(rawMetrics, endpoint.definition)); err != nil {
+			return err
+		}
+		if endpoint.populateDynamic != nil {
+			endpoint.populateDynamic(sample, rawMetrics)
+		}
+	}
+	return nil
+}
+
+// responseCodesPopulator reports the rate of each response status code found in the flattened zone metrics, e.g.
+// responses.codes.404 is reported as <prefix>404PerSecond.
+func responseCodesPopulator(prefix string) func(*metric.Set, map[string]interface{}) {
+	return func(sample *metric.Set, rawMetrics map[string]interface{}) {
+		for key, value := range rawMetrics {
+			if !strings.HasPrefix(key, responseCodesSource) {
+				continue
+			}
+			code := strings.TrimPrefix(key, responseCodesSource)
+			if err := sample.SetMetric(fmt.Sprintf("%s%sPerSecond", prefix, code), value, metric.PRATE); err != nil {
+				log.Warn("Error setting value: %s", err)
+			}
+		}
+	}
+}
+
+// populateSlabSlots reports the allocation requests and failures of each slot size found in the flattened slab
+// metrics, e.g. slots.64.reqs is reported as slab.slots.64.reqsPerSecond.
+func populateSlabSlots(sample *metric.Set, rawMetrics map[string]interface{}) {
+	for key, value := range rawMetrics {
+		if !strings.HasPrefix(key, slabSlotsSource) {
+			continue
+		}
+		slot := strings.TrimPrefix(key, slabSlotsSource)
+		var err error
+		switch {
+		case strings.HasSuffix(slot, ".reqs"):
+			err = sample.SetMetric(fmt.Sprintf("slab.slots.%sPerSecond", slot), value, metric.PRATE)
+		case strings.HasSuffix(slot, ".fails"):
+			err = sample.SetMetric(fmt.Sprintf("slab.slots.%s", slot), value, metric.PDELTA)
+		}
+		if err != nil {
+			log.Warn("Error setting value: %s", err)
+		}
+	}
+}
+
+func (inst *instance) populateUpstreamPeerMetrics(e *integration.Entity, endpoint plusAPIUpstreamEndpoint, upstream string, peer map[string]interface{}) error {
+	server, ok := peer["server"].(string)
+	if !ok {
+		return errors.New("peer without server address")
+	}
+
+	rawMetrics, err := flatten.Flatten(peer, "", flatten.DotStyle)
+	if err != nil {
+		return err
+	}
+
+	sample := inst.metricSet(e, endpoint.peerEventType, inst.args.RemoteMonitoring,
+		attribute.Attr("upstream", upstream),
+		attribute.Attr("server", server),
+	)
+	if err := populateMetrics(sample, rawMetrics, presentDefinitions(rawMetrics, endpoint.peerDefinition)); err != nil {
+		return err
+	}
+
+	if downstart, ok := peerDownstart(peer["downstart"]); ok {
+		if err := sample.SetMetric(endpoint.peerPrefix+"downstart", downstart, metric.ATTRIBUTE); err != nil {
+			log.Warn("Error setting value: %s", err)
+		}
+	}
+
+	if state, ok := peer["state"].(string); ok && inst.store != nil {
+		reportPeerStateChange(e, inst.store, endpoint, upstream, server, state)
+	}
+	return nil
+}
+
+// reportPeerStateChange adds an event to the entity when the state of the peer differs from the one stored in the
+// previous execution, and stores the current one.
+func reportPeerStateChange(e *integration.Entity, store persist.Storer, endpoint plusAPIUpstreamEndpoint, upstream, server, state string) {
+	key := fmt.Sprintf("peerState::%s::%s::%s", endpoint.path, upstream, server)
+
+	var oldState string
+	_, err := store.Get(key, &oldState)
+	store.Set(key, state)
+	if err != nil {
+		if !errors.Is(err, persist.ErrNotFound) {
+			log.Warn("Unable to get previous state of peer %s of upstream %s: %s", server, upstream, err)
+		}
+		return
+	}
+	if oldState == state {
+		return
+	}
+
+	summary := fmt.Sprintf("Peer %s of upstream %s changed state from %s to %s", server, upstream, oldState, state)
+	err = e.AddEvent(event.NewWithAttributes(summary, peerStateChangeCategory, map[string]interface{}{
+		"endpoint": endpoint.path,
+		"upstream": upstream,
+		"server":   server,
+		"oldState": oldState,
+		"newState": state,
+	}))
+	if err != nil {
+		log.Warn("Unable to add event: %s", err)
+	}
+}
+
+// peerDownstart returns the time a peer went down. Older API versions report it in milliseconds since the epoch
+// instead of as a timestamp.
+func peerDownstart(rawDownstart interface{}) (string, bool) {
+	switch downstart := rawDownstart.(type) {
+	case string:
+		return downstart, true
+	case float64:
+		return time.UnixMilli(int64(downstart)).UTC().Format(time.RFC3339Nano), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdk_args "github.com/newrelic/infra-integrations-sdk/v3/args"
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNginxPlusApiUpstreams = `{
+  "backend": {
+    "peers": [
+      {
+        "id": 0,
+        "server": "10.0.0.1:8080",
+        "name": "10.0.0.1:8080",
+        "backup": false,
+        "weight": 1,
+        "state": "up",
+        "active": 3,
+        "requests": 667231,
+        "header_time": 20,
+        "response_time": 36,
+        "responses": {"1xx": 0, "2xx": 666310, "3xx": 0, "4xx": 915, "5xx": 6, "total": 667231},
+        "sent": 251946292,
+        "received": 19222475454,
+        "fails": 0,
+        "unavail": 0,
+        "health_checks": {"checks": 26214, "fails": 0, "unhealthy": 0, "last_passed": true},
+        "downtime": 0,
+        "selected": "2022-06-28T11:09:21Z"
+      },
+      {
+        "id": 1,
+        "server": "10.0.0.2:8080",
+        "name": "10.0.0.2:8080",
+        "backup": true,
+        "weight": 1,
+        "state": "unhealthy",
+        "active": 0,
+        "requests": 0,
+        "responses": {"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0, "total": 0},
+        "sent": 0,
+        "received": 0,
+        "fails": 3,
+        "unavail": 1,
+        "health_checks": {"checks": 26284, "fails": 26284, "unhealthy": 1, "last_passed": false},
+        "downtime": 262925617,
+        "downstart": "2022-06-25T10:06:43.427Z"
+      }
+    ],
+    "keepalive": 2,
+    "zombies": 0,
+    "zone": "backend"
+  }
+}`
+
+// newPlusAPITestServer serves the given bodies by path, returning an empty JSON object for any other path.
+func newPlusAPITestServer(t *testing.T, bodies map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			body = "{}"
+		}
+		_, err := io.WriteString(w, body)
+		assert.NoError(t, err)
+	}))
+}
+
+// findMetricSet returns the metric set of the given event type having all the given attribute values.
+func findMetricSet(e *integration.Entity, eventType string, attrs map[string]string) *metric.Set {
+	for _, ms := range e.Metrics {
+		if ms.Metrics["event_type"] != eventType {
+			continue
+		}
+		matches := true
+		for k, v := range attrs {
+			if ms.Metrics[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return ms
+		}
+	}
+	return nil
+}
+
+func Test_pollHTTPAPIUpstreams(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{"/http/upstreams": testNginxPlusApiUpstreams})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIUpstreamEndpoints {
+		require.NoError(t, inst.pollHTTPAPIUpstreams(e, endpoint))
+	}
+	require.Len(t, e.Metrics, 3)
+
+	upstream := findMetricSet(e, upstreamEventType, map[string]string{"upstream": "backend"})
+	require.NotNil(t, upstream)
+	assert.Equal(t, "backend", upstream.Metrics["upstream.zone"])
+	assert.Equal(t, float64(2), upstream.Metrics["upstream.keepaliveConnections"])
+	assert.Equal(t, float64(2), upstream.Metrics["upstream.peers"])
+	assert.Equal(t, float64(1), upstream.Metrics["upstream.peersUp"])
+
+	up := findMetricSet(e, upstreamPeerEventType, map[string]string{"upstream": "backend", "server": "10.0.0.1:8080"})
+	require.NotNil(t, up)
+	assert.Equal(t, "up", up.Metrics["peer.state"])
+	assert.Equal(t, float64(3), up.Metrics["peer.connectionsActive"])
+	assert.Equal(t, float64(36), up.Metrics["peer.responseTimeMs"])
+	assert.Contains(t, up.Metrics, "peer.responses5xxPerSecond")
+	assert.NotContains(t, up.Metrics, "peer.downstart")
+
+	down := findMetricSet(e, upstreamPeerEventType, map[string]string{"upstream": "backend", "server": "10.0.0.2:8080"})
+	require.NotNil(t, down)
+	assert.Equal(t, "unhealthy", down.Metrics["peer.state"])
+	assert.Equal(t, "2022-06-25T10:06:43.427Z", down.Metrics["peer.downstart"])
+	assert.NotContains(t, down.Metrics, "peer.responseTimeMs")
+}
+
+func Test_peerDownstart(t *testing.T) {
+	downstart, ok := peerDownstart(float64(1656151603427))
+	assert.True(t, ok)
+	assert.Equal(t, "2022-06-25T10:06:43.427Z", downstart)
+
+	_, ok = peerDownstart(nil)
+	assert.False(t, ok)
+}
+
+var testNginxPlusApiServerZones = `{
+  "site1": {
+    "processing": 2,
+    "requests": 736395,
+    "responses": {
+      "1xx": 0, "2xx": 727290, "3xx": 4614, "4xx": 934, "5xx": 1535, "total": 734373,
+      "codes": {"200": 727270, "301": 4614, "404": 930, "503": 1535}
+    },
+    "discarded": 2020,
+    "received": 180157219,
+    "sent": 20183175459
+  }
+}`
+
+var testNginxPlusApiLocationZones = `{
+  "api_v1": {
+    "requests": 8411,
+    "responses": {"1xx": 0, "2xx": 8100, "3xx": 0, "4xx": 301, "5xx": 10, "total": 8411, "codes": {"200": 8100}},
+    "discarded": 0,
+    "received": 2200311,
+    "sent": 1732030
+  }
+}`
+
+func Test_pollHTTPAPIZones(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{
+		"/http/server_zones":   testNginxPlusApiServerZones,
+		"/http/location_zones": testNginxPlusApiLocationZones,
+	})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIZoneEndpoints {
+		require.NoError(t, inst.pollHTTPAPIZones(e, endpoint))
+	}
+
+	zone := findMetricSet(e, serverZoneEventType, map[string]string{"zone": "site1"})
+	require.NotNil(t, zone)
+	assert.Equal(t, float64(2), zone.Metrics["serverZone.processing"])
+	for _, m := range []string{
+		"serverZone.requestsPerSecond",
+		"serverZone.responses5xxPerSecond",
+		"serverZone.responses404PerSecond",
+		"serverZone.bytesSentPerSecond",
+	} {
+		assert.Contains(t, zone.Metrics, m)
+	}
+
+	location := findMetricSet(e, locationZoneEventType, map[string]string{"zone": "api_v1"})
+	require.NotNil(t, location)
+	for _, m := range []string{
+		"locationZone.requestsPerSecond",
+		"locationZone.responses4xxPerSecond",
+		"locationZone.responses200PerSecond",
+		"locationZone.discardedPerSecond",
+		"locationZone.bytesReceivedPerSecond",
+	} {
+		assert.Contains(t, location.Metrics, m)
+	}
+}
+
+var testNginxPlusApiCaches = `{
+  "http_cache": {
+    "size": 530915328,
+    "max_size": 536870912,
+    "cold": false,
+    "hit": {"responses": 254032, "bytes": 6685627875},
+    "stale": {"responses": 0, "bytes": 0},
+    "updating": {"responses": 0, "bytes": 0},
+    "revalidated": {"responses": 0, "bytes": 0},
+    "miss": {"responses": 1619201, "bytes": 53841943822, "responses_written": 44992, "bytes_written": 1445824161},
+    "expired": {"responses": 45859, "bytes": 1656847080},
+    "bypass": {"responses": 200187, "bytes": 5510647548}
+  }
+}`
+
+func Test_pollHTTPAPIZones_caches(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{"/http/caches": testNginxPlusApiCaches})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIZoneEndpoints {
+		require.NoError(t, inst.pollHTTPAPIZones(e, endpoint))
+	}
+
+	cache := findMetricSet(e, cacheEventType, map[string]string{"zone": "http_cache"})
+	require.NotNil(t, cache)
+	assert.Equal(t, float64(536870912), cache.Metrics["cache.maxSizeBytes"])
+	assert.Equal(t, float64(0), cache.Metrics["cache.cold"])
+	assert.InDelta(t, 11.9867, cache.Metrics["cache.hitPercent"], 0.0001)
+	assert.Contains(t, cache.Metrics, "cache.bypassBytesPerSecond")
+}
+
+func Test_cacheHitPercent(t *testing.T) {
+	_, ok := cacheHitPercent(map[string]interface{}{})
+	assert.False(t, ok)
+
+	percent, ok := cacheHitPercent(map[string]interface{}{"hit.responses": float64(3), "miss.responses": float64(1)})
+	assert.True(t, ok)
+	assert.Equal(t, float64(75), percent)
+}
+
+var testNginxPlusApiStreamServerZones = `{
+  "postgres": {
+    "processing": 1,
+    "connections": 2021,
+    "sessions": {"2xx": 2010, "4xx": 0, "5xx": 11, "total": 2021},
+    "discarded": 0,
+    "received": 3421144,
+    "sent": 982121301
+  }
+}`
+
+var testNginxPlusApiStreamUpstreams = `{
+  "postgres_backends": {
+    "peers": [
+      {
+        "id": 0,
+        "server": "10.0.1.5:5432",
+        "name": "10.0.1.5:5432",
+        "backup": false,
+        "weight": 1,
+        "state": "up",
+        "active": 1,
+        "connections": 2021,
+        "connect_time": 1,
+        "first_byte_time": 4,
+        "response_time": 1530,
+        "sent": 3421144,
+        "received": 982121301,
+        "fails": 0,
+        "unavail": 0,
+        "health_checks": {"checks": 0, "fails": 0, "unhealthy": 0},
+        "downtime": 0
+      }
+    ],
+    "zombies": 0,
+    "zone": "postgres_backends"
+  }
+}`
+
+func Test_pollStreamEndpoints(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{
+		"/stream/server_zones": testNginxPlusApiStreamServerZones,
+		"/stream/upstreams":    testNginxPlusApiStreamUpstreams,
+	})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIZoneEndpoints {
+		require.NoError(t, inst.pollHTTPAPIZones(e, endpoint))
+	}
+	for _, endpoint := range plusAPIUpstreamEndpoints {
+		require.NoError(t, inst.pollHTTPAPIUpstreams(e, endpoint))
+	}
+
+	zone := findMetricSet(e, streamServerZoneEventType, map[string]string{"zone": "postgres"})
+	require.NotNil(t, zone)
+	assert.Equal(t, float64(1), zone.Metrics["streamServerZone.processing"])
+	assert.Contains(t, zone.Metrics, "streamServerZone.sessions5xxPerSecond")
+
+	upstream := findMetricSet(e, streamUpstreamEventType, map[string]string{"upstream": "postgres_backends"})
+	require.NotNil(t, upstream)
+	assert.Equal(t, float64(1), upstream.Metrics["streamUpstream.peersUp"])
+
+	peer := findMetricSet(e, streamUpstreamPeerEventType, map[string]string{"upstream": "postgres_backends", "server": "10.0.1.5:5432"})
+	require.NotNil(t, peer)
+	assert.Equal(t, "up", peer.Metrics["streamPeer.state"])
+	assert.Equal(t, float64(4), peer.Metrics["streamPeer.firstByteTimeMs"])
+	assert.Equal(t, float64(1), peer.Metrics["streamPeer.connectTimeMs"])
+	assert.Contains(t, peer.Metrics, "streamPeer.connectionsPerSecond")
+}
+
+func Test_pollHTTPAPIZones_limits(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{
+		"/http/limit_reqs":  `{"one": {"passed": 15, "delayed": 4, "rejected": 0, "delayed_dry_run": 1, "rejected_dry_run": 2}}`,
+		"/http/limit_conns": `{"addr": {"passed": 320, "rejected": 12, "rejected_dry_run": 0}}`,
+	})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIZoneEndpoints {
+		require.NoError(t, inst.pollHTTPAPIZones(e, endpoint))
+	}
+
+	limitReq := findMetricSet(e, limitReqEventType, map[string]string{"zone": "one"})
+	require.NotNil(t, limitReq)
+	for m := range limitReqDefinition {
+		assert.Contains(t, limitReq.Metrics, m)
+	}
+
+	limitConn := findMetricSet(e, limitConnEventType, map[string]string{"zone": "addr"})
+	require.NotNil(t, limitConn)
+	for m := range limitConnDefinition {
+		assert.Contains(t, limitConn.Metrics, m)
+	}
+}
+
+var testNginxPlusApiSlabs = `{
+  "upstreams": {
+    "pages": {"used": 30, "free": 10},
+    "slots": {
+      "8": {"used": 0, "free": 0, "reqs": 0, "fails": 0},
+      "64": {"used": 38, "free": 25, "reqs": 38, "fails": 2},
+      "128": {"used": 2, "free": 30, "reqs": 12, "fails": 0}
+    }
+  }
+}`
+
+func Test_pollHTTPAPIZones_slabs(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{"/slabs": testNginxPlusApiSlabs})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	for _, endpoint := range plusAPIZoneEndpoints {
+		require.NoError(t, inst.pollHTTPAPIZones(e, endpoint))
+	}
+
+	slab := findMetricSet(e, slabEventType, map[string]string{"zone": "upstreams"})
+	require.NotNil(t, slab)
+	assert.Equal(t, float64(30), slab.Metrics["slab.pagesUsed"])
+	assert.Equal(t, float64(75), slab.Metrics["slab.pagesUsedPercent"])
+	for _, m := range []string{"slab.reqsPerSecond", "slab.fails", "slab.slots.64.reqsPerSecond", "slab.slots.64.fails"} {
+		assert.Contains(t, slab.Metrics, m)
+	}
+}
+
+func Test_sumSlabSlots(t *testing.T) {
+	metrics := map[string]interface{}{
+		"pages.used":     float64(1),
+		"slots.8.reqs":   float64(3),
+		"slots.8.fails":  float64(1),
+		"slots.64.reqs":  float64(4),
+		"slots.64.fails": float64(0),
+	}
+	reqs, ok := slabSlotsReqs(metrics)
+	assert.True(t, ok)
+	assert.Equal(t, float64(7), reqs)
+
+	fails, ok := slabSlotsFails(metrics)
+	assert.True(t, ok)
+	assert.Equal(t, float64(1), fails)
+
+	_, ok = slabSlotsReqs(map[string]interface{}{})
+	assert.False(t, ok)
+}
+
+func Test_reportPeerStateChange(t *testing.T) {
+	inst := &instance{args: argumentList{StatusURL: "http://localhost/api/9", RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	store := persist.NewInMemoryStore()
+	endpoint := plusAPIUpstreamEndpoints[0]
+
+	reportPeerStateChange(e, store, endpoint, "backend", "10.0.0.1:8080", "up")
+	assert.Empty(t, e.Events, "no event expected on the first execution")
+
+	reportPeerStateChange(e, store, endpoint, "backend", "10.0.0.1:8080", "up")
+	assert.Empty(t, e.Events, "no event expected when the state didn't change")
+
+	reportPeerStateChange(e, store, endpoint, "backend", "10.0.0.1:8080", "unhealthy")
+	require.Len(t, e.Events, 1)
+	assert.Equal(t, peerStateChangeCategory, e.Events[0].Category)
+	assert.Equal(t, "up", e.Events[0].Attributes["oldState"])
+	assert.Equal(t, "unhealthy", e.Events[0].Attributes["newState"])
+	assert.Equal(t, "backend", e.Events[0].Attributes["upstream"])
+	assert.Equal(t, "10.0.0.1:8080", e.Events[0].Attributes["server"])
+
+	reportPeerStateChange(e, store, endpoint, "backend", "10.0.0.2:8080", "down")
+	assert.Len(t, e.Events, 1, "peers are tracked independently")
+}
+
+func Test_pollHTTPAPIUpstreams_stateChanges(t *testing.T) {
+	ts := newPlusAPITestServer(t, map[string]string{"/http/upstreams": testNginxPlusApiUpstreams})
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+
+	inst.store = persist.NewInMemoryStore()
+	inst.store.Set("peerState::/http/upstreams::backend::10.0.0.2:8080", "up")
+
+	require.NoError(t, inst.pollHTTPAPIUpstreams(e, plusAPIUpstreamEndpoints[0]))
+	require.Len(t, e.Events, 1)
+	assert.Equal(t, "10.0.0.2:8080", e.Events[0].Attributes["server"])
+	assert.Equal(t, "unhealthy", e.Events[0].Attributes["newState"])
+}
+
+func Test_pollHttpAPIStatusEndpoints_partialFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/connections":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/stream/server_zones", "/stream/upstreams":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("content-type", "application/json")
+			_, err := io.WriteString(w, "{}")
+			assert.NoError(t, err)
+		}
+	}))
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{StatusURL: ts.URL, RemoteMonitoring: true}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	e, err := inst.entity(i)
+	require.NoError(t, err)
+	ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+
+	require.NoError(t, inst.pollHttpAPIStatusEndpoints(e, ms))
+	require.Len(t, inst.scrapeErrors, 1, "endpoints not found aren't errors")
+	assert.Equal(t, stageMetrics, inst.scrapeErrors[0].stage)
+	assert.Contains(t, inst.scrapeErrors[0].err.Error(), "/connections")
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	inst.scrapeErrors = nil
+	assert.Error(t, inst.pollHttpAPIStatusEndpoints(e, ms))
+	assert.Empty(t, inst.scrapeErrors)
+}
+
+func Test_pollHttpAPIStatusEndpoints_allNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	inst := &instance{args: argumentList{
+		DefaultArgumentList: sdk_args.DefaultArgumentList{Metrics: true},
+		StatusURL:           ts.URL,
+		StatusModule:        httpAPIStatus,
+		RemoteMonitoring:    true,
+	}}
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+
+	assert.Error(t, inst.collect(i), "a wrong NGINX Plus API URL collects nothing")
+	require.Len(t, inst.scrapeErrors, 1)
+	assert.Contains(t, inst.scrapeErrors[0].err.Error(), "no NGINX Plus API core endpoint could be read")
+}
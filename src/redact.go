@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/newrelic/infra-integrations-sdk/v3/persist"
+	"github.com/pkg/errors"
+)
+
+const (
+	redactionKeyStoreKey = "redactionKey"
+	redactionKeySize     = 32
+	// redactionKeyTTL keeps the redaction key while the integration runs at least once a year, as a new key changes
+	// the hash of every redacted value.
+	redactionKeyTTL      = 365 * 24 * time.Hour
+	redactionKeyFilePerm = 0600
+)
+
+// redactedDirectives are the directives whose whole value is a secret, or the file holding one.
+var redactedDirectives = []string{
+	"auth_jwt_key_file",
+	"secure_link_secret",
+	"ssl_password_file",
+	"proxy_ssl_password_file",
+	"grpc_ssl_password_file",
+	"uwsgi_ssl_password_file",
+	"ssl_session_ticket_key",
+}
+
+// nameValueDirectives have a header or parameter name as first argument, whose value is redacted when the name is
+// sensitive, e.g. proxy_set_header Authorization "Bearer ...".
+var nameValueDirectives = map[string]bool{
+	"add_header":       true,
+	"add_trailer":      true,
+	"proxy_set_header": true,
+	"grpc_set_header":  true,
+	"fastcgi_param":    true,
+	"uwsgi_param":      true,
+	"scgi_param":       true,
+}
+
+var (
+	// sensitiveName matches the header, parameter and variable names holding secrets.
+	sensitiveName = regexp.MustCompile(`(?i)authorization|cookie|passw(or)?d|secret|token|api[-_]?key|credential`)
+
+	// redactedValuePatterns match the secrets found in any directive value: credentials in URLs and HTTP
+	// authorization schemes.
+	redactedValuePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`[^\s/:@"']+:[^\s/@"']+@`),
+		regexp.MustCompile(`(?i)\b(bearer|basic)\s+[\w\-.~+/]+=*`),
+	}
+)
+
+// configRedactor replaces the secrets in the configuration reported as inventory with a keyed hash of their value, so
+// their changes are still detected without the hash revealing low-entropy secrets.
+type configRedactor struct {
+	// key is the HMAC key of the redacted values.
+	key        []byte
+	directives map[string]bool
+	patterns   []*regexp.Regexp
+}
+
+// newConfigRedactor creates a redactor for the built-in sensitive directives and values, plus the comma-separated
+// directive names and the JSON list of regular expressions set in the arguments. Without a key, a random one is used,
+// so the redacted values change on every execution.
+func newConfigRedactor(key []byte, directives, patterns string) (*configRedactor, error) {
+	if len(key) == 0 {
+		var err error
+		if key, err = newRedactionKey(); err != nil {
+			return nil, err
+		}
+	}
+	r := &configRedactor{
+		key:        key,
+		directives: make(map[string]bool, len(redactedDirectives)),
+		patterns:   append([]*regexp.Regexp{}, redactedValuePatterns...),
+	}
+	for _, name := range redactedDirectives {
+		r.directives[name] = true
+	}
+	for _, name := range strings.Split(directives, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			r.directives[name] = true
+		}
+	}
+
+	if patterns != "" {
+		var expressions []string
+		if err := json.Unmarshal([]byte(patterns), &expressions); err != nil {
+			return nil, fmt.Errorf("redacted value patterns must be a JSON list of regular expressions: %w", err)
+		}
+		for _, expression := range expressions {
+			re, err := regexp.Compile(expression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redacted value pattern '%s': %w", expression, err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+	}
+	return r, nil
+}
+
+// redact returns the name and value of the directive, in the block of the parent, to report as inventory.
+func (r *configRedactor) redact(d, parent *configDirective) (name, value string) {
+	name, value = d.name, d.rawValue()
+	if parent != nil && parent.name == "map" && len(parent.args) > 1 {
+		// The entries of a map from a sensitive variable are secrets, as are the values mapped to a sensitive one.
+		if sensitiveName.MatchString(parent.args[0]) {
+			name = r.redactedValue(name)
+		}
+		if sensitiveName.MatchString(parent.args[1]) {
+			return name, r.redactedValue(value)
+		}
+	}
+
+	switch {
+	case r.directives[d.name]:
+		return name, r.redactedValue(value)
+	case nameValueDirectives[d.name] && len(d.args) > 1 && sensitiveName.MatchString(d.args[0]):
+		return name, d.rawArgs[0] + " " + r.redactedValue(strings.Join(d.rawArgs[1:], " "))
+	case d.name == "set" && len(d.args) > 1 && sensitiveName.MatchString(d.args[0]):
+		return name, d.rawArgs[0] + " " + r.redactedValue(strings.Join(d.rawArgs[1:], " "))
+	}
+
+	for _, re := range r.patterns {
+		value = re.ReplaceAllStringFunc(value, r.redactedValue)
+	}
+	return name, value
+}
+
+// redactBlock returns the arguments of a block directive, which are part of the inventory keys of the directives in
+// its block. The values compared to sensitive variables in if blocks, e.g. if ($http_authorization = "Bearer ..."), are
+// redacted, as well as the values matching the patterns. Without a redactor, the arguments are returned as written.
+func (r *configRedactor) redactBlock(d *configDirective) string {
+	value := d.rawValue()
+	if r == nil {
+		return value
+	}
+
+	if d.name == "if" && len(d.args) > 2 && sensitiveName.MatchString(d.args[0]) {
+		operand := strings.Join(d.rawArgs[2:], " ")
+		closing := ""
+		if strings.HasSuffix(operand, ")") {
+			operand, closing = strings.TrimSpace(strings.TrimSuffix(operand, ")")), " )"
+		}
+		value = d.rawArgs[0] + " " + d.rawArgs[1] + " " + r.redactedValue(operand) + closing
+	}
+	for _, re := range r.patterns {
+		value = re.ReplaceAllStringFunc(value, r.redactedValue)
+	}
+	return value
+}
+
+// redactedValue replaces a secret with the beginning of its HMAC-SHA-256.
+func (r *configRedactor) redactedValue(secret string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(secret))
+	return fmt.Sprintf("(redacted:%x)", mac.Sum(nil)[:8])
+}
+
+func newRedactionKey() ([]byte, error) {
+	key := make([]byte, redactionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("cannot generate redaction key: %w", err)
+	}
+	return key, nil
+}
+
+// loadRedactionKey returns the redaction key of the installation, and its store to save once the execution is done.
+func loadRedactionKey(i *integration.Integration, tempDir string) ([]byte, persist.Storer, error) {
+	store, err := newRedactionKeyStore(i, tempDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := redactionKey(store)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, store, nil
+}
+
+// newRedactionKeyStore creates the store of the redaction key, shared by every instance monitored by the installation
+// so the same secret is redacted the same way in all of them.
+func newRedactionKeyStore(i *integration.Integration, tempDir string) (persist.Storer, error) {
+	storePath, err := persist.NewStorePath(integrationName+"-redaction", "key", tempDir, i.Logger(), redactionKeyTTL)
+	if err != nil {
+		return nil, err
+	}
+	path := storePath.GetFilePath()
+	store, err := persist.NewFileStore(path, i.Logger(), redactionKeyTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &redactionKeyStore{Storer: store, path: path}, nil
+}
+
+// redactionKeyStore is a file store only readable by its owner, as the key would allow brute-forcing the redacted
+// values, while the SDK file stores can be read by any user.
+type redactionKeyStore struct {
+	persist.Storer
+	path string
+}
+
+// Save restricts the permissions of the file, creating it when it doesn't exist yet, before the SDK store writes to it,
+// which keeps them.
+func (s *redactionKeyStore) Save() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE, redactionKeyFilePerm)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(s.path, redactionKeyFilePerm); err != nil {
+		return err
+	}
+	return s.Storer.Save()
+}
+
+// redactionKey returns the redaction key of the store, generating it on the first execution. The key is stored again
+// to renew its TTL.
+func redactionKey(store persist.Storer) ([]byte, error) {
+	var key []byte
+	_, err := store.Get(redactionKeyStoreKey, &key)
+	if err != nil && !errors.Is(err, persist.ErrNotFound) {
+		return nil, err
+	}
+	if len(key) != redactionKeySize {
+		if key, err = newRedactionKey(); err != nil {
+			return nil, err
+		}
+	}
+	store.Set(redactionKeyStoreKey, key)
+	return key, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/metric"
+)
+
+// statusTLS is the TLS connection to an HTTPS status URL, as negotiated by the first request to it.
+type statusTLS struct {
+	// version and cipherSuite are zero when the handshake failed verifying the certificate.
+	version     uint16
+	cipherSuite uint16
+	// chain are the certificates presented by the server, its own first.
+	chain []*x509.Certificate
+	// verifyErr is the reason the chain isn't trusted for the status URL host, nil when it is.
+	verifyErr error
+}
+
+// recordStatusTLS keeps the TLS connection state of the first HTTPS response from the status URL. The chain is verified
+// even when VALIDATE_CERTS is false, so a misconfigured chain is reported anyway.
+func (inst *instance) recordStatusTLS(state *tls.ConnectionState) {
+	if inst.statusTLS != nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	inst.statusTLS = &statusTLS{
+		version:     state.Version,
+		cipherSuite: state.CipherSuite,
+		chain:       state.PeerCertificates,
+	}
+	if len(state.VerifiedChains) == 0 {
+		inst.statusTLS.verifyErr = inst.verifyStatusChain(state.PeerCertificates)
+	}
+}
+
+// recordStatusTLSVerificationError keeps the chain the status URL presented when the handshake failed verifying it.
+func (inst *instance) recordStatusTLSVerificationError(err *tls.CertificateVerificationError) {
+	if inst.statusTLS != nil || len(err.UnverifiedCertificates) == 0 {
+		return
+	}
+	inst.statusTLS = &statusTLS{chain: err.UnverifiedCertificates, verifyErr: err.Err}
+}
+
+// verifyStatusChain verifies the chain as the HTTP client does when VALIDATE_CERTS is true: with the CA bundle or the
+// system certificate pool, for the TLS server name or the status URL host.
+func (inst *instance) verifyStatusChain(chain []*x509.Certificate) error {
+	tlsConfig, err := inst.statusTLSConfig()
+	if err != nil {
+		return err
+	}
+	serverName := tlsConfig.ServerName
+	if serverName == "" {
+		statusURL, err := url.Parse(inst.args.StatusURL)
+		if err != nil {
+			return err
+		}
+		serverName = statusURL.Hostname()
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// populateStatusTLSMetrics reports the TLS connection to an HTTPS status URL: the negotiated protocol and cipher suite,
+// whether the presented chain is trusted, and the expiry of the server certificate and of the whole chain, which
+// expires when its first certificate does.
+func (inst *instance) populateStatusTLSMetrics(sample *metric.Set) {
+	if inst.statusTLS == nil {
+		return
+	}
+
+	cert := inst.statusTLS.chain[0]
+	chainNotAfter := cert.NotAfter
+	for _, c := range inst.statusTLS.chain[1:] {
+		if c.NotAfter.Before(chainNotAfter) {
+			chainNotAfter = c.NotAfter
+		}
+	}
+	verified, verificationError := 1, ""
+	if inst.statusTLS.verifyErr != nil {
+		verified, verificationError = 0, inst.statusTLS.verifyErr.Error()
+	}
+	now := time.Now()
+	protocol, cipherSuite := "", ""
+	if inst.statusTLS.version != 0 {
+		protocol = tls.VersionName(inst.statusTLS.version)
+		cipherSuite = tls.CipherSuiteName(inst.statusTLS.cipherSuite)
+	}
+
+	rawMetrics := map[string]interface{}{
+		"tls.protocol":                    protocol,
+		"tls.cipherSuite":                 cipherSuite,
+		"tls.verified":                    verified,
+		"tls.verificationError":           verificationError,
+		"tls.chainLength":                 len(inst.statusTLS.chain),
+		"tls.chain.daysUntilExpiry":       chainNotAfter.Sub(now).Hours() / 24,
+		"tls.certificate.subject":         cert.Subject.String(),
+		"tls.certificate.issuer":          cert.Issuer.String(),
+		"tls.certificate.notAfter":        cert.NotAfter.UTC().Format(time.RFC3339),
+		"tls.certificate.daysUntilExpiry": cert.NotAfter.Sub(now).Hours() / 24,
+	}
+	setRawMetrics(sample, rawMetrics)
+}
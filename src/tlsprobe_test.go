@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopulateStatusTLSMetrics(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, testNginxStandardStatus)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+
+	i, err := integration.New(t.Name(), "test", integration.InMemoryStore())
+	require.NoError(t, err)
+	collect := func(args argumentList) map[string]interface{} {
+		args.StatusURL = ts.URL
+		args.StatusModule = httpStubStatus
+		args.RemoteMonitoring = true
+		inst := &instance{args: args}
+		e, err := inst.entity(i)
+		require.NoError(t, err)
+		ms := inst.metricSet(e, "NginxSample", inst.args.RemoteMonitoring)
+		_ = inst.getMetricsData(e, ms)
+		inst.populateStatusTLSMetrics(ms)
+		return ms.Metrics
+	}
+
+	// The self-signed certificate is reported as untrusted even without validation.
+	metrics := collect(argumentList{ValidateCerts: false})
+	assert.Equal(t, float64(0), metrics["tls.verified"])
+	assert.Contains(t, metrics["tls.verificationError"], "unknown authority")
+	assert.Equal(t, "TLS 1.3", metrics["tls.protocol"])
+	assert.NotEmpty(t, metrics["tls.cipherSuite"])
+	assert.Equal(t, "O=Acme Co", metrics["tls.certificate.issuer"])
+	assert.Equal(t, float64(1), metrics["tls.chainLength"])
+	assert.Greater(t, metrics["tls.certificate.daysUntilExpiry"], float64(0))
+	assert.Equal(t, metrics["tls.certificate.daysUntilExpiry"], metrics["tls.chain.daysUntilExpiry"])
+
+	metrics = collect(argumentList{ValidateCerts: false, CABundleFile: caBundle})
+	assert.Equal(t, float64(1), metrics["tls.verified"])
+	assert.NotContains(t, metrics, "tls.verificationError")
+
+	// The presented chain is still reported when the handshake fails verifying it.
+	metrics = collect(argumentList{ValidateCerts: true})
+	assert.Equal(t, float64(0), metrics["tls.verified"])
+	assert.Contains(t, metrics["tls.verificationError"], "unknown authority")
+	assert.NotContains(t, metrics, "tls.protocol")
+	assert.Contains(t, metrics, "tls.certificate.notAfter")
+}
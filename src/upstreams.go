@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+)
+
+// Defaults of the upstream server parameters, when the server line doesn't set them.
+const (
+	defaultUpstreamMethod      = "round_robin"
+	defaultUpstreamWeight      = "1"
+	defaultUpstreamMaxFails    = "1"
+	defaultUpstreamFailTimeout = "10s"
+)
+
+// upstreamMethods are the load balancing method directives of upstream blocks.
+var upstreamMethods = map[string]bool{
+	"least_conn": true,
+	"least_time": true,
+	"ip_hash":    true,
+	"hash":       true,
+	"random":     true,
+}
+
+// configUpstream is an upstream block of the http or stream context.
+type configUpstream struct {
+	name    string
+	context string
+	// method is the load balancing method with its arguments, e.g. "hash $request_uri consistent".
+	method string
+	// zone is the shared memory zone of the upstream, with its size.
+	zone    string
+	servers []*upstreamServer
+	file    string
+}
+
+// upstreamServer is a server line of an upstream block.
+type upstreamServer struct {
+	address     string
+	weight      string
+	maxFails    string
+	failTimeout string
+	backup      bool
+	down        bool
+	// params are the rest of the parameters of the server line, e.g. max_conns=100 or resolve.
+	params []string
+}
+
+// configUpstreams returns the upstream blocks of the http and stream contexts, in the order they're found.
+func configUpstreams(directives []*configDirective) []*configUpstream {
+	var upstreams []*configUpstream
+	for _, context := range directives {
+		if !context.isBlock() || (context.name != "http" && context.name != "stream") {
+			continue
+		}
+		for _, d := range context.block {
+			if d.isBlock() && d.name == "upstream" && len(d.args) > 0 {
+				upstreams = append(upstreams, newConfigUpstream(context.name, d))
+			}
+		}
+	}
+	return upstreams
+}
+
+func newConfigUpstream(context string, block *configDirective) *configUpstream {
+	upstream := &configUpstream{name: block.args[0], context: context, method: defaultUpstreamMethod, file: block.file}
+	for _, d := range block.block {
+		switch {
+		case d.isBlock():
+		case upstreamMethods[d.name]:
+			upstream.method = strings.Join(append([]string{d.name}, d.args...), " ")
+		case d.name == "zone":
+			upstream.zone = strings.Join(d.args, " ")
+		case d.name == "server" && len(d.args) > 0:
+			upstream.servers = append(upstream.servers, newUpstreamServer(d.args))
+		}
+	}
+	return upstream
+}
+
+func newUpstreamServer(args []string) *upstreamServer {
+	server := &upstreamServer{
+		address:     args[0],
+		weight:      defaultUpstreamWeight,
+		maxFails:    defaultUpstreamMaxFails,
+		failTimeout: defaultUpstreamFailTimeout,
+	}
+	for _, arg := range args[1:] {
+		name, value, _ := strings.Cut(arg, "=")
+		switch name {
+		case "weight":
+			server.weight = value
+		case "max_fails":
+			server.maxFails = value
+		case "fail_timeout":
+			server.failTimeout = value
+		case "backup":
+			server.backup = true
+		case "down":
+			server.down = true
+		default:
+			server.params = append(server.params, arg)
+		}
+	}
+	return server
+}
+
+// addUpstreamItems reports each upstream as an inventory item keyed by its context and name, e.g.
+// "upstreams/http:backend", followed by an item per server keyed by its address, e.g.
+// "upstreams/http:backend/server:10.0.0.1:8080". Upstreams, or servers in the same upstream, with the same key are
+// indexed, like repeated directives.
+func addUpstreamItems(i *inventory.Inventory, upstreams []*configUpstream) error {
+	occurrences := make(map[string]int)
+	indexedKey := func(key string) string {
+		n := occurrences[key]
+		occurrences[key]++
+		if n > 0 {
+			return fmt.Sprintf("%s[%d]", key, n)
+		}
+		return key
+	}
+
+	for _, upstream := range upstreams {
+		key := indexedKey(fmt.Sprintf("upstreams/%s:%s", upstream.context, strings.Replace(upstream.name, "/", ":", -1)))
+		addresses := make([]string, 0, len(upstream.servers))
+		for _, server := range upstream.servers {
+			addresses = append(addresses, server.address)
+		}
+		err := setItemFields(i, key, map[string]interface{}{
+			"context": upstream.context,
+			"method":  upstream.method,
+			"zone":    upstream.zone,
+			"servers": strings.Join(addresses, ","),
+			"source":  upstream.file,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, server := range upstream.servers {
+			serverKey := indexedKey(fmt.Sprintf("%s/server:%s", key, strings.Replace(server.address, "/", ":", -1)))
+			err := setItemFields(i, serverKey, map[string]interface{}{
+				"weight":      server.weight,
+				"maxFails":    server.maxFails,
+				"failTimeout": server.failTimeout,
+				"backup":      server.backup,
+				"down":        server.down,
+				"params":      strings.Join(server.params, " "),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamInventory(t *testing.T) {
+	i := inventory.New()
+	require.NoError(t, populateInventory(bufio.NewReader(strings.NewReader(`
+http {
+  upstream dns {
+    server 10.0.3.1:8053;
+  }
+  upstream backend {
+    zone backend 64k;
+    hash $request_uri consistent;
+    server 10.0.0.1:8080 weight=5 max_fails=3 fail_timeout=30s;
+    server 10.0.0.2:8080 max_conns=100;
+    server 10.0.0.3:8080 backup;
+    server unix:/run/app.sock down;
+  }
+  upstream static {
+    server 10.0.1.1;
+    server 10.0.1.1;
+  }
+}
+stream {
+  upstream dns {
+    least_conn;
+    server 10.0.2.1:53;
+  }
+}
+`)), i))
+	items := i.Items()
+
+	backend := items["upstreams/http:backend"]
+	require.NotNil(t, backend)
+	assert.Equal(t, "http", backend["context"])
+	assert.Equal(t, "hash $request_uri consistent", backend["method"])
+	assert.Equal(t, "backend 64k", backend["zone"])
+	assert.Equal(t, "10.0.0.1:8080,10.0.0.2:8080,10.0.0.3:8080,unix:/run/app.sock", backend["servers"])
+
+	server := items["upstreams/http:backend/server:10.0.0.1:8080"]
+	assert.Equal(t, "5", server["weight"])
+	assert.Equal(t, "3", server["maxFails"])
+	assert.Equal(t, "30s", server["failTimeout"])
+	assert.Equal(t, false, server["backup"])
+
+	server = items["upstreams/http:backend/server:10.0.0.2:8080"]
+	assert.Equal(t, defaultUpstreamWeight, server["weight"])
+	assert.Equal(t, defaultUpstreamMaxFails, server["maxFails"])
+	assert.Equal(t, defaultUpstreamFailTimeout, server["failTimeout"])
+	assert.Equal(t, "max_conns=100", server["params"])
+
+	assert.Equal(t, true, items["upstreams/http:backend/server:10.0.0.3:8080"]["backup"])
+	assert.Equal(t, true, items["upstreams/http:backend/server:unix::run:app.sock"]["down"])
+
+	assert.Equal(t, defaultUpstreamMethod, items["upstreams/http:static"]["method"])
+	assert.Contains(t, items, "upstreams/http:static/server:10.0.1.1[1]", "repeated servers are indexed")
+
+	assert.Equal(t, "stream", items["upstreams/stream:dns"]["context"])
+	assert.Equal(t, "least_conn", items["upstreams/stream:dns"]["method"])
+	assert.Equal(t, "http", items["upstreams/http:dns"]["context"], "upstreams of each context have their own key")
+	assert.NotContains(t, items, "upstreams/stream:dns[1]")
+}
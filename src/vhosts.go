@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/v3/data/inventory"
+)
+
+// defaultListen is the address NGINX listens on for server blocks without listen directives.
+const defaultListen = "80"
+
+// virtualHost is an http server block, with the settings that tell it apart from the other virtual hosts.
+type virtualHost struct {
+	serverNames []string
+	// listen are the addresses of the listen directives, e.g. "443" or "[::]:443".
+	listen []string
+	// root is the root of the server block, or the one it inherits from the http block.
+	root string
+	// tls is true when the server accepts TLS connections, with listen ... ssl or ssl on.
+	tls          bool
+	certificates []string
+	returns      []string
+	rewrites     []string
+	locations    []*location
+	file         string
+}
+
+// location is a location block of a virtual host. Nested locations are listed after the location they're in.
+type location struct {
+	// match is the modifier and URI of the location, e.g. "= /status" or "~ \.php$".
+	match     string
+	proxyPass string
+	// root is the root or alias of the location, or the root it inherits.
+	root     string
+	returns  []string
+	rewrites []string
+}
+
+// virtualHosts returns the server blocks of the http blocks of the configuration, in the order they're found. Values
+// are redacted as in the rest of the inventory.
+func virtualHosts(directives []*configDirective, redactor *configRedactor) []*virtualHost {
+	var hosts []*virtualHost
+	for _, http := range directives {
+		if !http.isBlock() || http.name != "http" {
+			continue
+		}
+
+		var root string
+		var certificates []string
+		for _, d := range http.block {
+			switch {
+			case d.isBlock():
+			case d.name == "root":
+				_, root = redactor.redact(d, http)
+			case d.name == "ssl_certificate" && len(d.args) > 0:
+				certificates = append(certificates, d.args[0])
+			}
+		}
+
+		for _, server := range http.block {
+			if server.isBlock() && server.name == "server" {
+				hosts = append(hosts, newVirtualHost(server, root, certificates, redactor))
+			}
+		}
+	}
+	return hosts
+}
+
+func newVirtualHost(server *configDirective, root string, certificates []string, redactor *configRedactor) *virtualHost {
+	host := &virtualHost{root: root, tls: serverTLS(server), file: server.file}
+	var serverCertificates []string
+	for _, d := range server.block {
+		if d.isBlock() {
+			if d.name == "location" {
+				host.locations = append(host.locations, newLocations(d, "", redactor)...)
+			}
+			continue
+		}
+
+		_, value := redactor.redact(d, server)
+		switch d.name {
+		case "server_name":
+			host.serverNames = append(host.serverNames, d.args...)
+		case "listen":
+			if len(d.args) > 0 {
+				host.listen = append(host.listen, d.args[0])
+			}
+		case "ssl_certificate":
+			if len(d.args) > 0 {
+				serverCertificates = append(serverCertificates, d.args[0])
+			}
+		case "root":
+			host.root = value
+		case "return":
+			host.returns = append(host.returns, value)
+		case "rewrite":
+			host.rewrites = append(host.rewrites, value)
+		}
+	}
+
+	// Locations without a root of their own inherit the one of the server, wherever it's set in the block.
+	for _, l := range host.locations {
+		if l.root == "" {
+			l.root = host.root
+		}
+	}
+	host.certificates = certificates
+	if len(serverCertificates) > 0 {
+		host.certificates = serverCertificates
+	}
+	if len(host.listen) == 0 {
+		host.listen = []string{defaultListen}
+	}
+	return host
+}
+
+// serverTLS returns whether a server block accepts TLS connections, with listen ... ssl or ssl on.
+func serverTLS(server *configDirective) bool {
+	for _, d := range server.block {
+		if d.isBlock() || len(d.args) == 0 {
+			continue
+		}
+		switch d.name {
+		case "listen":
+			for _, arg := range d.args[1:] {
+				if arg == "ssl" {
+					return true
+				}
+			}
+		case "ssl":
+			if d.args[0] == "on" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newLocations returns the location and the locations nested in it, which inherit its root.
+func newLocations(block *configDirective, root string, redactor *configRedactor) []*location {
+	l := &location{match: redactor.redactBlock(block)}
+	var nested []*configDirective
+	for _, d := range block.block {
+		if d.isBlock() {
+			if d.name == "location" {
+				nested = append(nested, d)
+			}
+			continue
+		}
+
+		_, value := redactor.redact(d, block)
+		switch d.name {
+		case "proxy_pass":
+			l.proxyPass = value
+		case "root", "alias":
+			l.root = value
+		case "return":
+			l.returns = append(l.returns, value)
+		case "rewrite":
+			l.rewrites = append(l.rewrites, value)
+		}
+	}
+
+	if l.root == "" {
+		l.root = root
+	}
+	locations := []*location{l}
+	for _, d := range nested {
+		locations = append(locations, newLocations(d, l.root, redactor)...)
+	}
+	return locations
+}
+
+// key identifies the virtual host by its first server name and listen address, e.g. "example.com:443". Server blocks
+// without server names are named _, as the catch-all server name.
+func (h *virtualHost) key() string {
+	name := "_"
+	if len(h.serverNames) > 0 && h.serverNames[0] != "" {
+		name = h.serverNames[0]
+	}
+	return strings.Replace(fmt.Sprintf("%s:%s", name, h.listen[0]), "/", ":", -1)
+}
+
+// addVirtualHostItems reports each virtual host as an inventory item keyed by its first server name and listen address,
+// e.g. "virtualhosts/example.com:443", followed by an item per location, e.g.
+// "virtualhosts/example.com:443/location::api". Virtual hosts with the same key are indexed, like repeated directives.
+func addVirtualHostItems(i *inventory.Inventory, hosts []*virtualHost) error {
+	occurrences := make(map[string]int)
+	for _, host := range hosts {
+		key := "virtualhosts/" + host.key()
+		n := occurrences[key]
+		occurrences[key]++
+		if n > 0 {
+			key = fmt.Sprintf("%s[%d]", key, n)
+		}
+
+		matches := make([]string, 0, len(host.locations))
+		for _, l := range host.locations {
+			matches = append(matches, l.match)
+		}
+		fields := map[string]interface{}{
+			"serverNames":  strings.Join(host.serverNames, ","),
+			"listen":       strings.Join(host.listen, ","),
+			"root":         host.root,
+			"tls":          host.tls,
+			"certificates": strings.Join(host.certificates, ","),
+			"locations":    strings.Join(matches, "; "),
+			"return":       strings.Join(host.returns, "; "),
+			"rewrite":      strings.Join(host.rewrites, "; "),
+			"source":       host.file,
+		}
+		if err := setItemFields(i, key, fields); err != nil {
+			return err
+		}
+
+		for _, l := range host.locations {
+			locationKey := fmt.Sprintf("%s/location:%s", key, strings.Replace(l.match, "/", ":", -1))
+			err := setItemFields(i, locationKey, map[string]interface{}{
+				"proxyPass": l.proxyPass,
+				"root":      l.root,
+				"return":    strings.Join(l.returns, "; "),
+				"rewrite":   strings.Join(l.rewrites, "; "),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setItemFields sets the fields of an inventory item, leaving out the empty strings.
+func setItemFields(i *inventory.Inventory, key string, fields map[string]interface{}) error {
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := i.SetItem(key, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}